@@ -16,8 +16,15 @@
 package args
 
 import (
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
 	"github.com/lpabon/godbc"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
 )
 
 const (
@@ -27,6 +34,56 @@ const (
 	TB = 1024 * GB
 )
 
+var (
+	// Cache types created by simulator.NewCache
+	CacheTypes = []string{
+		"simple",
+		"null",
+		"iocache",
+		"clockpro",
+		"lru",
+		"arc",
+		"2q",
+		"slru",
+		"lirs",
+		"sieve",
+		"s3fifo",
+		"opt",
+		"partitioned",
+		"boltdb",
+		"iodb",
+	}
+
+	// Cache types which support writeback
+	WriteBackCacheTypes = []string{"iocache"}
+
+	// Cache types which support an admission policy
+	AdmissionCacheTypes = []string{
+		"simple",
+		"iocache",
+		"clockpro",
+		"lru",
+		"arc",
+		"2q",
+		"slru",
+		"lirs",
+		"sieve",
+		"s3fifo",
+		"partitioned",
+		"boltdb",
+		"iodb",
+	}
+)
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // Command line
 type Args struct {
 	blocksize, numfiles, apps    int
@@ -35,70 +92,553 @@ type Args struct {
 	dataperiod, deletion_percent int
 	pagecachesize, cachesize     int
 	randomfilesize, writethrough bool
+	writeback                    bool
 	cachetype                    string
+	tracefile, traceformat       string
+	workload                     string
+	zipf_s, zipf_v               float64
+	mrcfile                      string
+	mrcsamplerate                float64
+	mrcpoints                    int
 	maxfilesize                  uint64
 	bcpercent                    float64
 	pagecacheblocks, cacheblocks uint64
 	maxfileblocks, bcsize        uint64
 	warmupstats, warmup          bool
+	output                       string
+	metricsfile, warmupmetrics   string
+	metricsformat                string
+	seed                         int64
+	share, client                int
+	privatefiles                 bool
+	sweepcachesize               string
+	sweepblocksize               string
+	sweeppagecachesize           string
+	sweepcachetype               string
+	sweepparallel                int
+	sweepsummary                 string
+	replications                 int
+	compare                      string
+	partition, partitionweights  string
+	partitionreserved            int
+	twoqkin, twoqkout            int
+	slruprotected, lirshir       int
+	admission                    string
+	s3fifosmall                  int
+	configfile                   string
+	clients                      []map[string]string
 }
 
 // Command line arguments variable
 var args Args
 
-func init() {
-	flag.IntVar(&args.blocksizekb, "blocksize", 64, "\n\tBlock size in KB.")
-	flag.Uint64Var(&args.maxfilesize, "maxfilesize", 80*1024, "\n\tMaximum file size MB. Default 80GB.")
-	flag.BoolVar(&args.randomfilesize, "randomfilesize", false,
+// Register the command line flags of the options in a
+func (a *Args) flags(f *flag.FlagSet) {
+	f.IntVar(&a.blocksizekb, "blocksize", 64, "\n\tBlock size in KB.")
+	f.Uint64Var(&a.maxfilesize, "maxfilesize", 80*1024, "\n\tMaximum file size MB. Default 80GB.")
+	f.BoolVar(&a.randomfilesize, "randomfilesize", false,
 		"\n\tCreate files of random size with a maximum of maxfilesize."+
 			"\n\tIf false, set the file size exactly to maxfilesize.")
-	flag.IntVar(&args.cachesize, "cachesize", 8, "\n\tCache size in GB.")
-	flag.Float64Var(&args.bcpercent, "bcpercent", 0.1, "\n\tBuffer Cache size as a percentage of the cache size")
-	flag.IntVar(&args.numfiles, "numfiles", 1, "\n\tNumber of files")
-	flag.IntVar(&args.numios, "ios", 100000, "\n\tNumber of IOs for each client")
-	//flag.IntVar(&args.deletion_percent, "deletions", 0, "\n\t% of File deletions")
-	flag.IntVar(&args.read_percent, "reads", 65, "\n\t% of Reads")
-	flag.BoolVar(&args.writethrough, "writethrough", true, "\n\tWritethrough or read miss")
-	flag.IntVar(&args.dataperiod, "dataperiod", 1000, "\n\tNumber of IOs per data collected")
-	flag.StringVar(&args.cachetype, "cachetype", "simple", "\n\tCache type to use."+
+	f.IntVar(&a.cachesize, "cachesize", 8, "\n\tCache size in GB.")
+	f.Float64Var(&a.bcpercent, "bcpercent", 0.1, "\n\tBuffer Cache size as a percentage of the cache size")
+	f.IntVar(&a.numfiles, "numfiles", 1, "\n\tNumber of files")
+	f.IntVar(&a.numios, "ios", 100000, "\n\tNumber of IOs for each client")
+	f.IntVar(&a.deletion_percent, "deletions", 0, "\n\t% of File deletions")
+	f.IntVar(&a.read_percent, "reads", 65, "\n\t% of Reads")
+	f.BoolVar(&a.writethrough, "writethrough", true, "\n\tWritethrough or read miss")
+	f.BoolVar(&a.writeback, "writeback", false,
+		"\n\tWrite-back caching: writes are absorbed by the cache and"+
+			"\n\tdestaged when evicted.  Overrides writethrough."+
+			"\n\tOnly supported by iocache.")
+	f.IntVar(&a.dataperiod, "dataperiod", 1000, "\n\tNumber of IOs per data collected")
+	f.StringVar(&a.cachetype, "cachetype", "simple", "\n\tCache type to use."+
 		"\n\tCache types with no IO backend:"+
-		"\n\t\tsimple, null, iocache."+
+		"\n\t\tsimple, null, iocache, clockpro, lru, arc, 2q, slru,"+
+		"\n\t\tlirs, sieve, s3fifo, opt, partitioned."+
 		"\n\tCache types with IO backends using iocache frontend:"+
 		"\n\t\tboltdb, iodb")
-	flag.IntVar(&args.pagecachesize, "pagecachesize", 0, "\n\tSize of VM page cache above the IO cache in MB")
-	flag.IntVar(&args.apps, "clients", 1, "\n\tNumber of clients")
-	flag.BoolVar(&args.warmupstats, "warmupstats", false, "\n\tPrint stats after warmup stage")
-	flag.BoolVar(&args.warmup, "warmup", true, "\n\tWarmup cache before running simulation")
+	f.StringVar(&a.admission, "admission", "none",
+		"\n\tAdmission policy deciding which read misses are inserted:"+
+			"\n\t\tnone: Every read miss is inserted"+
+			"\n\t\ttinylfu: A read miss is inserted if it was accessed"+
+			"\n\t\t\tmore often than the block it would evict."+
+			"\n\tNot supported by the null and opt cache types.")
+	f.StringVar(&a.partition, "partition", "static",
+		"\n\tHow the partitioned cache type is divided between the clients:"+
+			"\n\t\tstatic: Each client only uses its share of the cache"+
+			"\n\t\treserved: Each client keeps its share of partition_reserved"+
+			"\n\t\t\tand the rest of the cache is shared"+
+			"\n\t\tweighted: Clients share the whole cache, and evictions"+
+			"\n\t\t\tcome from the client most above its share")
+	f.StringVar(&a.partitionweights, "partition_weights", "",
+		"\n\tComma separated weights of the shares of the clients in"+
+			"\n\tthe partitioned cache.  If not set, shares are equal.")
+	f.IntVar(&a.partitionreserved, "partition_reserved", 50,
+		"\n\t% of the partitioned cache reserved for the clients"+
+			"\n\tin the reserved partition mode")
+	f.IntVar(&a.twoqkin, "twoq_kin", 25,
+		"\n\t% of the 2q cache used by the A1in queue of blocks"+
+			"\n\tseen once")
+	f.IntVar(&a.twoqkout, "twoq_kout", 50,
+		"\n\tNumber of blocks remembered by the A1out ghost queue"+
+			"\n\tof the 2q cache as a % of the cache size")
+	f.IntVar(&a.slruprotected, "slru_protected", 80,
+		"\n\t% of the slru cache used by the protected segment")
+	f.IntVar(&a.lirshir, "lirs_hir", 1,
+		"\n\t% of the lirs cache used by resident HIR blocks."+
+			"\n\tAt least one block is always used.")
+	f.IntVar(&a.s3fifosmall, "s3fifo_small", 10,
+		"\n\t% of the s3fifo cache used by the small queue")
+	f.IntVar(&a.pagecachesize, "pagecachesize", 0, "\n\tSize of VM page cache above the IO cache in MB")
+	f.IntVar(&a.apps, "clients", 1, "\n\tNumber of clients")
+	f.IntVar(&a.share, "share", 1,
+		"\n\tNumber of IOs generated by a client for each IO of -ios."+
+			"\n\tUsually set for each client in a -config file to give"+
+			"\n\tclients different shares of the IO.")
+	f.BoolVar(&a.privatefiles, "privatefiles", false,
+		"\n\tEach client accesses its own files instead of the"+
+			"\n\tfiles being shared by all the clients")
+	f.BoolVar(&a.warmupstats, "warmupstats", false, "\n\tPrint stats after warmup stage")
+	f.BoolVar(&a.warmup, "warmup", true, "\n\tWarmup cache before running simulation")
+	f.StringVar(&a.workload, "workload", "spc1", "\n\tWorkload generator used by each client:"+
+		"\n\t\tspc1: SPC1-like workload"+
+		"\n\t\tzipf: Zipf distribution over all file blocks"+
+		"\n\t\tuniform: Uniformly random blocks"+
+		"\n\t\tsequential: Sequential access through all files")
+	f.Float64Var(&a.zipf_s, "zipf_s", 1.1, "\n\tZipf workload s parameter.  Must be greater than 1")
+	f.Float64Var(&a.zipf_v, "zipf_v", 10, "\n\tZipf workload v parameter.  Must be at least 1")
+	f.StringVar(&a.mrcfile, "mrc", "", "\n\tCompute the LRU miss ratio curve for all cache sizes in a"+
+		"\n\tsingle pass and save it as CSV to this file.  Replaces cachetype.")
+	f.Float64Var(&a.mrcsamplerate, "mrc_samplerate", 1.0, "\n\tFraction of blocks sampled when computing the miss ratio curve."+
+		"\n\tValues below 1 reduce memory use for large working sets.")
+	f.IntVar(&a.mrcpoints, "mrc_points", 100, "\n\tNumber of cache sizes in the miss ratio curve")
+	f.StringVar(&a.tracefile, "trace", "", "\n\tReplay a block I/O trace file instead of generating I/O."+
+		"\n\tThe trace is replayed from the beginning when it ends.")
+	f.StringVar(&a.traceformat, "traceformat", "msr", "\n\tFormat of the trace file:"+
+		"\n\t\tmsr: SNIA MSR Cambridge CSV"+
+		"\n\t\tsimple: op,lba,len with lba and len in 512 byte sectors")
+	f.StringVar(&a.output, "output", "text", "\n\tFormat of the results report:"+
+		"\n\t\ttext: Human readable report"+
+		"\n\t\tjson: Single JSON document with configuration and stats")
+	f.StringVar(&a.metricsfile, "metrics", "cache.data", "\n\tFile to save the cache metrics collected every dataperiod")
+	f.StringVar(&a.warmupmetrics, "warmupmetrics", "cache-warmup.data",
+		"\n\tFile to save the cache metrics collected during warmup")
+	f.StringVar(&a.metricsformat, "metricsformat", "csv", "\n\tFormat of the metrics files:"+
+		"\n\t\tcsv: Comma separated values with a header row"+
+		"\n\t\ttsv: Tab separated values with a header row"+
+		"\n\t\tjsonl: One JSON object per line")
+	f.Int64Var(&a.seed, "seed", 0, "\n\tSeed for all random number generators.  Runs with the same"+
+		"\n\tseed and options produce the same cache stats."+
+		"\n\tIf 0, the seed is taken from the current time.")
+	f.StringVar(&a.sweepcachesize, "sweep_cachesize", "", "\n\tRun a sweep over these cache sizes in GB."+
+		"\n\tValues are a comma separated list of numbers or ranges lo:hi[:step]."+
+		"\n\tA step of the form xN multiplies instead of adds, e.g. 1:64:x2")
+	f.StringVar(&a.sweepblocksize, "sweep_blocksize", "", "\n\tRun a sweep over these block sizes in KB.  Same format as sweep_cachesize")
+	f.StringVar(&a.sweeppagecachesize, "sweep_pagecachesize", "",
+		"\n\tRun a sweep over these page cache sizes in MB.  Same format as sweep_cachesize")
+	f.StringVar(&a.sweepcachetype, "sweep_cachetype", "", "\n\tRun a sweep over this comma separated list of cache types")
+	f.IntVar(&a.sweepparallel, "sweep_parallel", runtime.NumCPU(),
+		"\n\tNumber of sweep or replication simulations run at the same time."+
+			"\n\tNOTE: Simulations of cache types with an IO backend or of"+
+			"\n\tthe spc1 workload, which is the default, always run one at"+
+			"\n\ta time.  Use another workload to run them in parallel.")
+	f.StringVar(&a.sweepsummary, "sweep_summary", "sweep.data",
+		"\n\tFile to save the final stats of each sweep combination."+
+			"\n\tWritten in metricsformat.")
+	f.IntVar(&a.replications, "replications", 1,
+		"\n\tRepeat the simulation with this many seeds derived from seed"+
+			"\n\tand report the mean, standard deviation and 95% confidence"+
+			"\n\tinterval of each cache stat.  Runs in parallel like sweeps.")
+	f.StringVar(&a.compare, "compare", "", "\n\tComma separated list of cache types to simulate side by side."+
+		"\n\tEvery cache sees the same request stream.  Replaces cachetype."+
+		"\n\tMetrics of each cache are saved to the metrics files with the"+
+		"\n\tcache type added to their names, so each cache type can only"+
+		"\n\tbe listed once.")
+	f.StringVar(&a.configfile, "config", "", "\n\tJSON or YAML scenario file with the options of the simulation"+
+		"\n\tand of each client.  Options on the command line override"+
+		"\n\tthe ones in the file.")
 }
 
+func init() {
+	args.flags(flag.CommandLine)
+}
+
+// Returns the options of the command line.  Parses the
+// command line the first time it is called.
 func NewArgs() *Args {
 	if !flag.Parsed() {
 		flag.Parse()
 
-		// Check parameters
-		godbc.Check(args.blocksizekb > 0, "blocksize must be greater than 0")
-		godbc.Check(args.maxfilesize > 0, "maxfilesize must be greater than 0")
-		godbc.Check(0 <= (args.read_percent) && (args.read_percent) <= 100, "reads must be between 0 and 100")
-		godbc.Check(0 <= (args.deletion_percent) && (args.deletion_percent) <= 100, "deletions must be between 0 and 100")
+		// Scenario file options not set on the command line
+		if args.configfile != "" {
+			err := args.loadConfig(flag.CommandLine, args.configfile)
+			godbc.Check(err == nil, err)
+		}
 
 		args.initialize()
+		err := args.Check()
+		godbc.Check(err == nil, err)
 	}
 
 	return &args
 }
 
+// Returns the default options without using the command line
+func New() *Args {
+	a := &Args{}
+	a.flags(flag.NewFlagSet("foocsim", flag.ContinueOnError))
+	a.initialize()
+
+	return a
+}
+
+// Set the option with this command line flag name
+func (a *Args) Set(name, value string) error {
+	// Registering the flags sets the options
+	// to their defaults, so restore them after
+	current := *a
+	f := flag.NewFlagSet("foocsim", flag.ContinueOnError)
+	a.flags(f)
+	*a = current
+
+	err := f.Set(name, value)
+	if err != nil {
+		return err
+	}
+	a.initialize()
+
+	return nil
+}
+
+type check struct {
+	ok  bool
+	msg string
+}
+
+func firstFailure(checks []check) error {
+	for _, c := range checks {
+		if !c.ok {
+			return errors.New(c.msg)
+		}
+	}
+	return nil
+}
+
+// Returns an error describing the first invalid option
+func (a *Args) Check() error {
+	err := firstFailure([]check{
+		{a.blocksizekb > 0, "blocksize must be greater than 0"},
+		{a.dataperiod > 0, "dataperiod must be greater than 0"},
+		{0 < a.mrcsamplerate && a.mrcsamplerate <= 1, "mrc_samplerate must be greater than 0 and at most 1"},
+		{a.mrcpoints > 0, "mrc_points must be greater than 0"},
+		{a.output == "text" || a.output == "json", "output must be text or json"},
+		{a.metricsformat == "csv" ||
+			a.metricsformat == "tsv" ||
+			a.metricsformat == "jsonl", "metricsformat must be csv, tsv or jsonl"},
+		{a.sweepparallel > 0, "sweep_parallel must be greater than 0"},
+		{a.replications > 0, "replications must be greater than 0"},
+		{a.replications == 1 || !a.Sweep(), "replications cannot be used in a sweep"},
+		{a.replications == 1 || a.mrcfile == "", "replications cannot be used with mrc"},
+		{a.compare == "" || (!a.Sweep() && a.replications == 1 && a.mrcfile == ""),
+			"compare cannot be used with sweeps, replications or mrc"},
+		{a.partition == "static" ||
+			a.partition == "reserved" ||
+			a.partition == "weighted", "partition must be static, reserved or weighted"},
+		{0 <= a.partitionreserved && a.partitionreserved <= 100,
+			"partition_reserved must be between 0 and 100"},
+		{0 <= a.twoqkin && a.twoqkin <= 100, "twoq_kin must be between 0 and 100"},
+		{a.twoqkout >= 0, "twoq_kout must be at least 0"},
+		{0 <= a.slruprotected && a.slruprotected <= 100,
+			"slru_protected must be between 0 and 100"},
+		{0 < a.lirshir && a.lirshir < 100, "lirs_hir must be between 1 and 99"},
+		{a.admission == "none" || a.admission == "tinylfu", "admission must be none or tinylfu"},
+		{0 < a.s3fifosmall && a.s3fifosmall < 100, "s3fifo_small must be between 1 and 99"},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.checkPartitionWeights()
+	if err != nil {
+		return err
+	}
+
+	for _, cachetype := range a.cacheTypes() {
+		err = a.checkCacheType(cachetype)
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Sweep() {
+		err = a.checkSweep()
+		if err != nil {
+			return err
+		}
+	}
+
+	if a.Compare() {
+		err = a.checkCompare()
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, client := range a.ClientConfigs() {
+		err = client.checkClient()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Each configuration of a sweep has its own cache blocks
+	configs := []*Args{a}
+	if a.Sweep() {
+		configs = a.SweepConfigs()
+	}
+	for _, config := range configs {
+		for _, cachetype := range config.cacheTypes() {
+			err = config.checkCacheBlocks(cachetype)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func parseWeights(s string) ([]int, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	var weights []int
+	for _, item := range strings.Split(s, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(item))
+		if err != nil || w <= 0 {
+			return nil, fmt.Errorf("Bad weight: %s", item)
+		}
+		weights = append(weights, w)
+	}
+
+	return weights, nil
+}
+
+func (a *Args) checkPartitionWeights() error {
+	weights, err := parseWeights(a.partitionweights)
+	if err != nil {
+		return fmt.Errorf("partition_weights: %v", err)
+	}
+	if weights != nil && len(weights) != a.apps {
+		return errors.New("partition_weights must have a weight for each client")
+	}
+
+	return nil
+}
+
+// Cache types which will be simulated
+func (a *Args) cacheTypes() []string {
+	switch {
+	case a.Sweep():
+		return sweepStrings(a.sweepcachetype, a.cachetype)
+	case a.Compare():
+		return sweepStrings(a.compare, a.cachetype)
+	}
+	return []string{a.cachetype}
+}
+
+// Check that the cache type exists and supports the options
+func (a *Args) checkCacheType(cachetype string) error {
+	return firstFailure([]check{
+		{contains(CacheTypes, cachetype), "Unknown cache type: " + cachetype},
+		{!a.writeback || contains(WriteBackCacheTypes, cachetype),
+			"writeback is not supported by " + cachetype},
+		{a.admission == "none" || contains(AdmissionCacheTypes, cachetype),
+			"admission is not supported by " + cachetype},
+	})
+}
+
+// Check that the cache has enough blocks for the cache type
+func (a *Args) checkCacheBlocks(cachetype string) error {
+	min := uint64(1)
+	switch cachetype {
+	case "null":
+		min = 0
+	case "lirs":
+		// At least one LIR and one HIR block
+		min = 2
+	case "partitioned":
+		// At least one block for each client
+		min = uint64(len(a.ClientConfigs()))
+	}
+
+	if a.cacheblocks < min {
+		return fmt.Errorf("%s needs a cache of at least %d blocks, but a cachesize of %d GB "+
+			"holds %d blocks of %d KB", cachetype, min, a.cachesize, a.cacheblocks, a.blocksizekb)
+	}
+	return nil
+}
+
+// Check the parameters which can be set for each client
+func (a *Args) checkClient() error {
+	return firstFailure([]check{
+		{a.maxfilesize > 0, "maxfilesize must be greater than 0"},
+		{0 <= a.read_percent && a.read_percent <= 100, "reads must be between 0 and 100"},
+		{0 <= a.deletion_percent && a.deletion_percent <= 100, "deletions must be between 0 and 100"},
+		{a.share > 0, "share must be greater than 0"},
+		{a.workload == "spc1" ||
+			a.workload == "zipf" ||
+			a.workload == "uniform" ||
+			a.workload == "sequential", "workload must be spc1, zipf, uniform or sequential"},
+		{a.zipf_s > 1, "zipf_s must be greater than 1"},
+		{a.zipf_v >= 1, "zipf_v must be at least 1"},
+		{a.traceformat == "msr" || a.traceformat == "simple", "traceformat must be msr or simple"},
+	})
+}
+
 func (a *Args) initialize() {
+	// Invalid options are reported by Check
+	if a.blocksizekb <= 0 {
+		return
+	}
+
 	a.blocksize = a.blocksizekb * KB
 	a.cacheblocks = uint64(GB*a.cachesize) / uint64(a.blocksize)
 	a.maxfileblocks = a.maxfilesize * uint64(MB) / uint64(a.blocksize)
 	a.pagecacheblocks = uint64(a.pagecachesize * MB / (a.blocksize))
 	a.bcsize = uint64(float64(GB*a.cachesize) * (a.bcpercent / 100.0))
+	if a.seed == 0 {
+		a.seed = time.Now().UnixNano()
+	}
+}
+
+func (a *Args) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		BlocksizeKB       int                 `json:"blocksize"`
+		MaxFileSize       uint64              `json:"maxfilesize"`
+		RandomFileSize    bool                `json:"randomfilesize"`
+		CacheSize         int                 `json:"cachesize"`
+		BcPercent         float64             `json:"bcpercent"`
+		NumFiles          int                 `json:"numfiles"`
+		Ios               int                 `json:"ios"`
+		Reads             int                 `json:"reads"`
+		Deletions         int                 `json:"deletions"`
+		Writethrough      bool                `json:"writethrough"`
+		WriteBack         bool                `json:"writeback"`
+		DataPeriod        int                 `json:"dataperiod"`
+		CacheType         string              `json:"cachetype"`
+		PageCacheSize     int                 `json:"pagecachesize"`
+		Clients           int                 `json:"clients"`
+		Share             int                 `json:"share"`
+		PrivateFiles      bool                `json:"privatefiles"`
+		WarmupStats       bool                `json:"warmupstats"`
+		Warmup            bool                `json:"warmup"`
+		Workload          string              `json:"workload"`
+		ZipfS             float64             `json:"zipf_s"`
+		ZipfV             float64             `json:"zipf_v"`
+		Mrc               string              `json:"mrc"`
+		MrcSampleRate     float64             `json:"mrc_samplerate"`
+		MrcPoints         int                 `json:"mrc_points"`
+		Trace             string              `json:"trace"`
+		TraceFormat       string              `json:"traceformat"`
+		Metrics           string              `json:"metrics"`
+		WarmupMetrics     string              `json:"warmupmetrics"`
+		MetricsFormat     string              `json:"metricsformat"`
+		Seed              int64               `json:"seed"`
+		Replications      int                 `json:"replications"`
+		Compare           string              `json:"compare"`
+		Partition         string              `json:"partition"`
+		PartitionWeights  string              `json:"partition_weights"`
+		PartitionReserved int                 `json:"partition_reserved"`
+		TwoQKin           int                 `json:"twoq_kin"`
+		TwoQKout          int                 `json:"twoq_kout"`
+		SlruProtected     int                 `json:"slru_protected"`
+		LirsHir           int                 `json:"lirs_hir"`
+		Admission         string              `json:"admission"`
+		S3FifoSmall       int                 `json:"s3fifo_small"`
+		Config            string              `json:"config"`
+		ClientOptions     []map[string]string `json:"client_options,omitempty"`
+		CacheBlocks       uint64              `json:"cacheblocks"`
+		PageCacheBlocks   uint64              `json:"pagecacheblocks"`
+		MaxFileBlocks     uint64              `json:"maxfileblocks"`
+	}{
+		a.blocksizekb,
+		a.maxfilesize,
+		a.randomfilesize,
+		a.cachesize,
+		a.bcpercent,
+		a.numfiles,
+		a.numios,
+		a.read_percent,
+		a.deletion_percent,
+		a.writethrough,
+		a.writeback,
+		a.dataperiod,
+		a.cachetype,
+		a.pagecachesize,
+		a.apps,
+		a.share,
+		a.privatefiles,
+		a.warmupstats,
+		a.warmup,
+		a.workload,
+		a.zipf_s,
+		a.zipf_v,
+		a.mrcfile,
+		a.mrcsamplerate,
+		a.mrcpoints,
+		a.tracefile,
+		a.traceformat,
+		a.metricsfile,
+		a.warmupmetrics,
+		a.metricsformat,
+		a.seed,
+		a.replications,
+		a.compare,
+		a.partition,
+		a.partitionweights,
+		a.partitionreserved,
+		a.twoqkin,
+		a.twoqkout,
+		a.slruprotected,
+		a.lirshir,
+		a.admission,
+		a.s3fifosmall,
+		a.configfile,
+		a.clients,
+		a.cacheblocks,
+		a.pagecacheblocks,
+		a.maxfileblocks,
+	})
+}
+
+func (a *Args) String() string {
+	b, err := json.MarshalIndent(a, "", "  ")
+	godbc.Check(err == nil, err)
+	return string(b) + "\n"
 }
 
 func (a *Args) Blocksize() uint32 {
 	return uint32(a.blocksize)
 }
 
+func (a *Args) BlocksizeKB() int {
+	return a.blocksizekb
+}
+
+func (a *Args) CacheSize() int {
+	return a.cachesize
+}
+
+func (a *Args) PageCacheSize() int {
+	return a.pagecachesize
+}
+
+func (a *Args) MaxFileSize() uint64 {
+	return a.maxfilesize
+}
+
 func (a *Args) Files() int {
 	return a.numfiles
 }
@@ -115,6 +655,19 @@ func (a *Args) ReadPercent() int {
 	return a.read_percent
 }
 
+func (a *Args) Share() int {
+	return a.share
+}
+
+func (a *Args) PrivateFiles() bool {
+	return a.privatefiles
+}
+
+// Index of the client in ClientConfigs
+func (a *Args) Client() int {
+	return a.client
+}
+
 func (a *Args) DataPeriod() int {
 	return a.dataperiod
 }
@@ -139,6 +692,10 @@ func (a *Args) Writethrough() bool {
 	return a.writethrough
 }
 
+func (a *Args) WriteBack() bool {
+	return a.writeback
+}
+
 func (a *Args) CacheType() string {
 	return a.cachetype
 }
@@ -151,6 +708,38 @@ func (a *Args) BufferCacheSize() uint64 {
 	return a.bcsize
 }
 
+func (a *Args) Workload() string {
+	return a.workload
+}
+
+func (a *Args) ZipfS() float64 {
+	return a.zipf_s
+}
+
+func (a *Args) ZipfV() float64 {
+	return a.zipf_v
+}
+
+func (a *Args) MrcFile() string {
+	return a.mrcfile
+}
+
+func (a *Args) MrcSampleRate() float64 {
+	return a.mrcsamplerate
+}
+
+func (a *Args) MrcPoints() int {
+	return a.mrcpoints
+}
+
+func (a *Args) TraceFile() string {
+	return a.tracefile
+}
+
+func (a *Args) TraceFormat() string {
+	return a.traceformat
+}
+
 func (a *Args) ShowWarmupStats() bool {
 	return a.warmupstats
 }
@@ -158,3 +747,79 @@ func (a *Args) ShowWarmupStats() bool {
 func (a *Args) UseWarmup() bool {
 	return a.warmup
 }
+
+func (a *Args) Output() string {
+	return a.output
+}
+
+func (a *Args) MetricsFile() string {
+	return a.metricsfile
+}
+
+func (a *Args) WarmupMetricsFile() string {
+	return a.warmupmetrics
+}
+
+func (a *Args) MetricsFormat() string {
+	return a.metricsformat
+}
+
+func (a *Args) Seed() int64 {
+	return a.seed
+}
+
+func (a *Args) Replications() int {
+	return a.replications
+}
+
+func (a *Args) Compare() bool {
+	return a.compare != ""
+}
+
+func (a *Args) S3FifoSmall() int {
+	return a.s3fifosmall
+}
+
+func (a *Args) Admission() string {
+	return a.admission
+}
+
+func (a *Args) Partition() string {
+	return a.partition
+}
+
+// Weights of the shares of the clients in the partitioned
+// cache, or nil if the shares are equal
+func (a *Args) PartitionWeights() []int {
+	weights, err := parseWeights(a.partitionweights)
+	godbc.Check(err == nil, err)
+	return weights
+}
+
+func (a *Args) PartitionReserved() int {
+	return a.partitionreserved
+}
+
+func (a *Args) TwoQKin() int {
+	return a.twoqkin
+}
+
+func (a *Args) TwoQKout() int {
+	return a.twoqkout
+}
+
+func (a *Args) SlruProtected() int {
+	return a.slruprotected
+}
+
+func (a *Args) LirsHir() int {
+	return a.lirshir
+}
+
+func (a *Args) SweepParallel() int {
+	return a.sweepparallel
+}
+
+func (a *Args) SweepSummaryFile() string {
+	return a.sweepsummary
+}
@@ -16,17 +16,360 @@
 package args
 
 import (
+	"flag"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
 func TestArgs(t *testing.T) {
-	a := NewArgs()
-	a.initialize()
+	a := New()
 
-	assert.Equal(t, a.maxfilesize, uint64(8*MB))
+	assert.Equal(t, uint64(80*1024), a.maxfilesize)
 	assert.Equal(t, a.blocksize, a.blocksizekb*KB)
 	assert.Equal(t, a.cacheblocks, uint64(a.cachesize*GB/a.blocksize))
 	assert.Equal(t, a.maxfileblocks, a.maxfilesize*uint64(MB)/uint64(a.blocksize))
 	assert.Equal(t, a.pagecacheblocks, uint64(a.pagecachesize*MB)/uint64(a.blocksize))
 }
+
+func TestParseSweepInts(t *testing.T) {
+	values, err := parseSweepInts("4")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{4}, values)
+
+	values, err = parseSweepInts("1,2, 8")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 8}, values)
+
+	values, err = parseSweepInts("2:5")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3, 4, 5}, values)
+
+	values, err = parseSweepInts("0:10:4,32")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 4, 8, 32}, values)
+
+	values, err = parseSweepInts("1:64:x2")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 4, 8, 16, 32, 64}, values)
+
+	for _, bad := range []string{"", "a", "1:", "4:2", "1:2:0", "1:8:x1", "0:8:x2", "1:2:3:4"} {
+		_, err = parseSweepInts(bad)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestSweepConfigs(t *testing.T) {
+	a := New()
+	assert.False(t, a.Sweep())
+
+	s := *a
+	s.sweepcachesize = "1,2"
+	s.sweepcachetype = "lru,arc"
+	s.sweepblocksize = "4"
+	assert.True(t, s.Sweep())
+
+	configs := s.SweepConfigs()
+	assert.Equal(t, 4, len(configs))
+	assert.Equal(t, "lru", configs[0].CacheType())
+	assert.Equal(t, 1, configs[0].CacheSize())
+	assert.Equal(t, "arc", configs[3].CacheType())
+	assert.Equal(t, 2, configs[3].CacheSize())
+	for _, c := range configs {
+		assert.False(t, c.Sweep())
+		assert.Equal(t, 4, c.BlocksizeKB())
+		assert.Equal(t, uint32(4*KB), c.Blocksize())
+		assert.Equal(t, uint64(c.CacheSize()*GB/(4*KB)), c.CacheBlocks())
+		assert.Equal(t, a.PageCacheSize(), c.PageCacheSize())
+		assert.Equal(t, a.Seed(), c.Seed())
+	}
+}
+
+func TestCheckCacheTypes(t *testing.T) {
+	a := New()
+	assert.NoError(t, a.Set("writeback", "true"))
+	assert.NoError(t, a.Set("sweep_cachetype", "iocache"))
+	assert.NoError(t, a.Check())
+
+	// Every cache type of the sweep must support writeback
+	assert.NoError(t, a.Set("sweep_cachetype", "iocache,lru"))
+	assert.Error(t, a.Check())
+
+	// The compared cache types replace the cache type
+	a = New()
+	assert.NoError(t, a.Set("writeback", "true"))
+	assert.NoError(t, a.Set("compare", "iocache"))
+	assert.NoError(t, a.Check())
+	assert.NoError(t, a.Set("compare", "iocache,arc"))
+	assert.Error(t, a.Check())
+
+	a = New()
+	assert.NoError(t, a.Set("admission", "tinylfu"))
+	assert.NoError(t, a.Set("cachetype", "lru"))
+	assert.NoError(t, a.Check())
+	assert.NoError(t, a.Set("cachetype", "opt"))
+	assert.Error(t, a.Check())
+}
+
+func TestCheckCacheBlocks(t *testing.T) {
+	// A cache of a single block
+	a := New()
+	assert.NoError(t, a.Set("cachesize", "1"))
+	assert.NoError(t, a.Set("blocksize", "1048576"))
+	assert.Equal(t, uint64(1), a.CacheBlocks())
+	assert.NoError(t, a.Check())
+	assert.NoError(t, a.Set("cachetype", "lirs"))
+	assert.Error(t, a.Check())
+
+	// Each sweep configuration is checked
+	a = New()
+	assert.NoError(t, a.Set("cachesize", "1"))
+	assert.NoError(t, a.Set("cachetype", "lirs"))
+	assert.NoError(t, a.Set("sweep_blocksize", "64,1048576"))
+	assert.Error(t, a.Check())
+	assert.NoError(t, a.Set("sweep_blocksize", "64,524288"))
+	assert.NoError(t, a.Check())
+
+	// The null cache has no blocks
+	a = New()
+	assert.NoError(t, a.Set("cachesize", "0"))
+	assert.Error(t, a.Check())
+	assert.NoError(t, a.Set("cachetype", "null"))
+	assert.NoError(t, a.Check())
+}
+
+func TestReplicationConfigs(t *testing.T) {
+	a := New()
+
+	r := *a
+	r.seed = 42
+	r.replications = 3
+	configs := r.ReplicationConfigs()
+	assert.Equal(t, 3, len(configs))
+	for i, c := range configs {
+		assert.Equal(t, 1, c.Replications())
+		assert.NotEqual(t, int64(42), c.Seed())
+		assert.NotEqual(t, int64(0), c.Seed())
+		for _, other := range configs[:i] {
+			assert.NotEqual(t, other.Seed(), c.Seed())
+		}
+	}
+
+	// Seeds only depend on the seed of the configuration
+	again := r.ReplicationConfigs()
+	for i := range configs {
+		assert.Equal(t, configs[i].Seed(), again[i].Seed())
+	}
+}
+
+func TestCompareConfigs(t *testing.T) {
+	a := New()
+	assert.False(t, a.Compare())
+	assert.Equal(t, 1, len(a.CompareConfigs()))
+
+	c := *a
+	c.compare = "simple, iocache,arc"
+	assert.True(t, c.Compare())
+
+	configs := c.CompareConfigs()
+	assert.Equal(t, 3, len(configs))
+	assert.Equal(t, "simple", configs[0].CacheType())
+	assert.Equal(t, "iocache", configs[1].CacheType())
+	assert.Equal(t, "arc", configs[2].CacheType())
+	for _, config := range configs {
+		assert.False(t, config.Compare())
+		assert.Equal(t, a.Seed(), config.Seed())
+		assert.Equal(t, a.CacheBlocks(), config.CacheBlocks())
+	}
+}
+
+func writeTestConfig(t *testing.T, pattern, data string) string {
+	fp, err := ioutil.TempFile("", pattern)
+	assert.NoError(t, err)
+	defer fp.Close()
+
+	_, err = fp.WriteString(data)
+	assert.NoError(t, err)
+
+	return fp.Name()
+}
+
+// Command line bound to a
+func testConfigFlags(a *Args) *flag.FlagSet {
+	f := flag.NewFlagSet("test", flag.ContinueOnError)
+	a.flags(f)
+	return f
+}
+
+func TestLoadConfigJson(t *testing.T) {
+	filename := writeTestConfig(t, "foocsim*.json", `{
+		"cachetype": "arc",
+		"cachesize": 16,
+		"clients": [
+			{"workload": "zipf", "reads": 90},
+			{"workload": "sequential", "numfiles": 4, "share": 3}
+		]
+	}`)
+	defer os.Remove(filename)
+
+	a := New()
+	f := testConfigFlags(a)
+	assert.NoError(t, f.Parse([]string{"-cachesize=4"}))
+	assert.NoError(t, a.loadConfig(f, filename))
+	a.initialize()
+
+	// Command line wins
+	assert.Equal(t, 4, a.CacheSize())
+	assert.Equal(t, "arc", a.CacheType())
+	assert.Equal(t, 2, a.Apps())
+
+	clients := a.ClientConfigs()
+	assert.Equal(t, 2, len(clients))
+	assert.Equal(t, "zipf", clients[0].Workload())
+	assert.Equal(t, 90, clients[0].ReadPercent())
+	assert.Equal(t, a.Files(), clients[0].Files())
+	assert.Equal(t, "sequential", clients[1].Workload())
+	assert.Equal(t, 65, clients[1].ReadPercent())
+	assert.Equal(t, 4, clients[1].Files())
+	assert.Equal(t, "arc", clients[1].CacheType())
+	assert.Equal(t, 1, clients[0].Share())
+	assert.Equal(t, 3, clients[1].Share())
+	assert.Equal(t, 0, clients[0].Client())
+	assert.Equal(t, 1, clients[1].Client())
+}
+
+func TestLoadConfigYaml(t *testing.T) {
+	filename := writeTestConfig(t, "foocsim*.yaml", `
+cachetype: lru
+clients:
+  - workload: uniform
+    zipf_s: 1.5
+`)
+	defer os.Remove(filename)
+
+	a := New()
+	f := testConfigFlags(a)
+	assert.NoError(t, f.Parse([]string{"-workload=zipf"}))
+	assert.NoError(t, a.loadConfig(f, filename))
+	a.initialize()
+
+	assert.Equal(t, "lru", a.CacheType())
+	assert.Equal(t, 1, a.Apps())
+
+	// Command line wins over client options too
+	clients := a.ClientConfigs()
+	assert.Equal(t, 1, len(clients))
+	assert.Equal(t, "zipf", clients[0].Workload())
+	assert.Equal(t, 1.5, clients[0].ZipfS())
+}
+
+func TestLoadConfigClients(t *testing.T) {
+	filename := writeTestConfig(t, "foocsim*.json", `{
+		"seed": 1234567890123456789,
+		"clients": [
+			{"workload": "zipf"},
+			{"workload": "sequential"},
+			{"workload": "uniform"}
+		]
+	}`)
+	defer os.Remove(filename)
+
+	a := New()
+	assert.NoError(t, a.loadConfig(testConfigFlags(a), filename))
+	assert.Equal(t, int64(1234567890123456789), a.Seed())
+	assert.Equal(t, 3, a.Apps())
+
+	// The command line truncates the list of clients
+	a = New()
+	f := testConfigFlags(a)
+	assert.NoError(t, f.Parse([]string{"-clients=2"}))
+	assert.NoError(t, a.loadConfig(f, filename))
+	clients := a.ClientConfigs()
+	assert.Equal(t, 2, len(clients))
+	assert.Equal(t, "zipf", clients[0].Workload())
+	assert.Equal(t, "sequential", clients[1].Workload())
+
+	// or extends it with clients using the shared options
+	a = New()
+	f = testConfigFlags(a)
+	assert.NoError(t, f.Parse([]string{"-clients=4", "-workload=spc1"}))
+	assert.NoError(t, a.loadConfig(f, filename))
+	clients = a.ClientConfigs()
+	assert.Equal(t, 4, len(clients))
+	assert.Equal(t, "spc1", clients[0].Workload())
+	assert.Equal(t, "spc1", clients[3].Workload())
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"nosuchoption": 1}`,
+		`{"cachesize": "big"}`,
+		`{"cachesize": [1, 2]}`,
+		`{"clients": [{"cachetype": "arc"}]}`,
+		`{"clients": [3]}`,
+		`{"cachesize": `,
+		`{"cachesize": 4} {}`,
+	} {
+		filename := writeTestConfig(t, "foocsim*.json", data)
+		a := New()
+		assert.Error(t, a.loadConfig(testConfigFlags(a), filename), data)
+		os.Remove(filename)
+	}
+
+	a := New()
+	assert.Error(t, a.loadConfig(testConfigFlags(a), "/nosuchfile.json"))
+}
+
+func TestSet(t *testing.T) {
+	a := New()
+	seed := a.Seed()
+
+	assert.NoError(t, a.Set("cachetype", "arc"))
+	assert.NoError(t, a.Set("blocksize", "4"))
+	assert.Equal(t, "arc", a.CacheType())
+	assert.Equal(t, uint32(4*KB), a.Blocksize())
+	assert.Equal(t, uint64(a.CacheSize()*GB/(4*KB)), a.CacheBlocks())
+
+	// Other options are not changed
+	assert.Equal(t, seed, a.Seed())
+	assert.Equal(t, 65, a.ReadPercent())
+
+	assert.Error(t, a.Set("nosuchoption", "1"))
+	assert.Error(t, a.Set("cachesize", "big"))
+}
+
+func TestCheck(t *testing.T) {
+	a := New()
+	assert.NoError(t, a.Check())
+
+	for _, option := range [][]string{
+		{"blocksize", "0"},
+		{"reads", "101"},
+		{"workload", "nosuchworkload"},
+		{"output", "xml"},
+		{"sweep_cachesize", "4:1"},
+		{"replications", "0"},
+		{"share", "0"},
+		{"deletions", "101"},
+		{"partition", "nosuchmode"},
+		{"partition_reserved", "101"},
+		{"partition_weights", "1,x"},
+		{"partition_weights", "1,2"},
+		{"twoq_kin", "101"},
+		{"twoq_kout", "-1"},
+		{"slru_protected", "101"},
+		{"lirs_hir", "0"},
+		{"admission", "lfu"},
+		{"s3fifo_small", "100"},
+		{"compare", "arc,lru,arc"},
+		{"cachetype", "bogus"},
+		{"sweep_cachetype", "lru,bogus"},
+		{"compare", "lru,bogus"},
+		{"writeback", "true"},
+	} {
+		a := New()
+		assert.NoError(t, a.Set(option[0], option[1]))
+		assert.Error(t, a.Check(), option[0])
+	}
+}
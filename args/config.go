@@ -0,0 +1,237 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+)
+
+// Options which can be set for each client
+func (a *Args) clientFlags() *flag.FlagSet {
+	f := flag.NewFlagSet("client", flag.ContinueOnError)
+	f.SetOutput(ioutil.Discard)
+	f.StringVar(&a.workload, "workload", a.workload, "")
+	f.IntVar(&a.read_percent, "reads", a.read_percent, "")
+	f.IntVar(&a.deletion_percent, "deletions", a.deletion_percent, "")
+	f.IntVar(&a.numfiles, "numfiles", a.numfiles, "")
+	f.Uint64Var(&a.maxfilesize, "maxfilesize", a.maxfilesize, "")
+	f.BoolVar(&a.randomfilesize, "randomfilesize", a.randomfilesize, "")
+	f.Float64Var(&a.zipf_s, "zipf_s", a.zipf_s, "")
+	f.Float64Var(&a.zipf_v, "zipf_v", a.zipf_v, "")
+	f.StringVar(&a.tracefile, "trace", a.tracefile, "")
+	f.StringVar(&a.traceformat, "traceformat", a.traceformat, "")
+	f.IntVar(&a.share, "share", a.share, "")
+
+	return f
+}
+
+func readConfig(filename string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	config := make(map[string]interface{})
+	switch filepath.Ext(filename) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &config)
+	default:
+		// Keep numbers as written so large integers
+		// like seeds do not lose precision
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&config)
+		if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+			err = errors.New("unexpected data after the scenario")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	return config, nil
+}
+
+// Convert a value from a scenario file to a flag value
+func configValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case string:
+		return value, nil
+	case json.Number:
+		return value.String(), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case int:
+		return strconv.Itoa(value), nil
+	case int64:
+		return strconv.FormatInt(value, 10), nil
+	case uint64:
+		return strconv.FormatUint(value, 10), nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	}
+
+	return "", fmt.Errorf("Unsupported value: %v", v)
+}
+
+// JSON objects decode as map[string]interface{} and
+// YAML mappings as map[interface{}]interface{}
+func configObject(v interface{}) (map[string]interface{}, bool) {
+	switch object := v.(type) {
+	case map[string]interface{}:
+		return object, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{})
+		for key, value := range object {
+			m[fmt.Sprint(key)] = value
+		}
+		return m, true
+	}
+
+	return nil, false
+}
+
+// Set the options of each client from the clients list of a
+// scenario file.  Options on the command line win.  If clients
+// was set on the command line, the list is truncated to that
+// number of clients, or the clients not listed use the options
+// shared by all the clients.
+func (a *Args) loadClients(list []interface{}, set map[string]bool) error {
+	clients := make([]map[string]string, len(list))
+	for i, item := range list {
+		options, ok := configObject(item)
+		if !ok {
+			return fmt.Errorf("clients: entry %d is not an object", i)
+		}
+
+		clients[i] = make(map[string]string)
+		for key, value := range options {
+			if set[key] {
+				continue
+			}
+
+			s, err := configValue(value)
+			if err == nil {
+				// Check the option on a scratch copy
+				scratch := *a
+				err = scratch.clientFlags().Set(key, s)
+			}
+			if err != nil {
+				return fmt.Errorf("clients: entry %d: %s: %v", i, key, err)
+			}
+			clients[i][key] = s
+		}
+	}
+
+	if !set["clients"] {
+		a.apps = len(clients)
+	} else if len(clients) > a.apps {
+		clients = clients[:a.apps]
+	}
+	a.clients = clients
+
+	return nil
+}
+
+// Set the options in a scenario file which were not set on the
+// command line parsed by flags.  Scenario files use the flag names
+// as keys, so any flag can be set, including the ones registered
+// by other packages.  Files ending in .yaml or .yml are YAML, all
+// others are JSON.  For example:
+//
+//	{
+//		"cachetype": "arc",
+//		"cachesize": 16,
+//		"pagecachesize": 512,
+//		"clients": [
+//			{"workload": "zipf", "reads": 90},
+//			{"workload": "sequential", "numfiles": 4}
+//		]
+//	}
+//
+// clients is either the number of clients or a list with the
+// options of each client.  Only the options in clientFlags can
+// be set for a client, for example {"workload": "zipf", "share": 2}.
+// The number of clients on the command line truncates or extends
+// the list.
+func (a *Args) loadConfig(flags *flag.FlagSet, filename string) error {
+	config, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	for key, value := range config {
+		// A client list is kept even if the number
+		// of clients is set on the command line
+		if list, ok := value.([]interface{}); ok && key == "clients" {
+			err = a.loadClients(list, set)
+			if err != nil {
+				return fmt.Errorf("%s: %v", filename, err)
+			}
+			continue
+		}
+
+		if set[key] {
+			continue
+		}
+
+		s, err := configValue(value)
+		if err == nil {
+			err = flags.Set(key, s)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", filename, key, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the configuration of each client.  Clients listed
+// in the scenario file have their own options applied.
+func (a *Args) ClientConfigs() []*Args {
+	configs := make([]*Args, a.apps)
+	for i := range configs {
+		config := *a
+		config.client = i
+		if i < len(a.clients) {
+			f := config.clientFlags()
+			for key, value := range a.clients[i] {
+				err := f.Set(key, value)
+				godbc.Check(err == nil, err)
+			}
+			config.initialize()
+		}
+		configs[i] = &config
+	}
+
+	return configs
+}
@@ -0,0 +1,210 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"fmt"
+	"github.com/lpabon/godbc"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Parse a comma separated list of integers.  Each item is either
+// a number or a range lo:hi[:step] including hi if it is reached.
+// A step of the form xN multiplies the value by N instead of adding.
+func parseSweepInts(s string) ([]int, error) {
+	var values []int
+
+	for _, item := range strings.Split(s, ",") {
+		fields := strings.Split(strings.TrimSpace(item), ":")
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("Bad sweep range: %s", item)
+		}
+
+		lo, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("Bad sweep value: %s", item)
+		}
+		if len(fields) == 1 {
+			values = append(values, lo)
+			continue
+		}
+
+		hi, err := strconv.Atoi(fields[1])
+		if err != nil || hi < lo {
+			return nil, fmt.Errorf("Bad sweep range: %s", item)
+		}
+
+		step, multiply := "1", false
+		if len(fields) == 3 {
+			step = fields[2]
+			if strings.HasPrefix(step, "x") {
+				step, multiply = step[1:], true
+			}
+		}
+		n, err := strconv.Atoi(step)
+		if err != nil || n < 1 || (multiply && (n < 2 || lo < 1)) {
+			return nil, fmt.Errorf("Bad sweep step: %s", item)
+		}
+
+		for v := lo; v <= hi; {
+			values = append(values, v)
+			if multiply {
+				v *= n
+			} else {
+				v += n
+			}
+		}
+	}
+
+	return values, nil
+}
+
+func sweepInts(s string, value int) []int {
+	if s == "" {
+		return []int{value}
+	}
+
+	values, err := parseSweepInts(s)
+	godbc.Check(err == nil, err)
+
+	return values
+}
+
+func sweepStrings(s string, value string) []string {
+	if s == "" {
+		return []string{value}
+	}
+
+	values := strings.Split(s, ",")
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+
+	return values
+}
+
+func (a *Args) checkSweep() error {
+	for _, s := range []string{a.sweepcachesize, a.sweepblocksize, a.sweeppagecachesize} {
+		if s != "" {
+			_, err := parseSweepInts(s)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	var checks []check
+	for _, v := range sweepInts(a.sweepcachesize, a.cachesize) {
+		checks = append(checks, check{v > 0, "sweep_cachesize values must be greater than 0"})
+	}
+	for _, v := range sweepInts(a.sweepblocksize, a.blocksizekb) {
+		checks = append(checks, check{v > 0, "sweep_blocksize values must be greater than 0"})
+	}
+	for _, v := range sweepInts(a.sweeppagecachesize, a.pagecachesize) {
+		checks = append(checks, check{v >= 0, "sweep_pagecachesize values must not be negative"})
+	}
+	checks = append(checks, check{a.mrcfile == "", "mrc cannot be used in a sweep"})
+
+	return firstFailure(checks)
+}
+
+// Returns true if any of the sweep parameters were set
+func (a *Args) Sweep() bool {
+	return a.sweepcachesize != "" ||
+		a.sweepblocksize != "" ||
+		a.sweeppagecachesize != "" ||
+		a.sweepcachetype != ""
+}
+
+// Returns one configuration for each combination of the sweep
+// parameters.  Parameters not being swept keep their value, and
+// all configurations share the same seed.
+func (a *Args) SweepConfigs() []*Args {
+	var configs []*Args
+
+	for _, cachetype := range sweepStrings(a.sweepcachetype, a.cachetype) {
+		for _, cachesize := range sweepInts(a.sweepcachesize, a.cachesize) {
+			for _, blocksize := range sweepInts(a.sweepblocksize, a.blocksizekb) {
+				for _, pagecachesize := range sweepInts(a.sweeppagecachesize, a.pagecachesize) {
+					config := *a
+					config.cachetype = cachetype
+					config.cachesize = cachesize
+					config.blocksizekb = blocksize
+					config.pagecachesize = pagecachesize
+
+					// Each configuration is a single run
+					config.sweepcachesize = ""
+					config.sweepblocksize = ""
+					config.sweeppagecachesize = ""
+					config.sweepcachetype = ""
+
+					config.initialize()
+					configs = append(configs, &config)
+				}
+			}
+		}
+	}
+
+	return configs
+}
+
+// Returns one configuration for each replication.  Each one has
+// its own seed derived from the seed of this configuration.
+func (a *Args) ReplicationConfigs() []*Args {
+	r := rand.New(rand.NewSource(a.seed))
+	configs := make([]*Args, a.replications)
+	for i := range configs {
+		config := *a
+		config.replications = 1
+		for config.seed == a.seed || config.seed == 0 {
+			config.seed = r.Int63()
+		}
+		configs[i] = &config
+	}
+
+	return configs
+}
+
+// Each compared cache saves its metrics to files named after its
+// cache type, and every cache sees the same options and requests,
+// so a cache type can only be compared once
+func (a *Args) checkCompare() error {
+	seen := make(map[string]bool)
+	for _, cachetype := range sweepStrings(a.compare, a.cachetype) {
+		if seen[cachetype] {
+			return fmt.Errorf("compare lists %s more than once", cachetype)
+		}
+		seen[cachetype] = true
+	}
+
+	return nil
+}
+
+// Returns one configuration for each cache type being compared
+func (a *Args) CompareConfigs() []*Args {
+	var configs []*Args
+
+	for _, cachetype := range sweepStrings(a.compare, a.cachetype) {
+		config := *a
+		config.cachetype = cachetype
+		config.compare = ""
+		configs = append(configs, &config)
+	}
+
+	return configs
+}
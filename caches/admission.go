@@ -0,0 +1,212 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/lpabon/godbc"
+	"hash/fnv"
+)
+
+// Caches which can filter the blocks inserted on read misses
+// with an admission policy
+type AdmissionCaches interface {
+	Caches
+
+	// Filter inserts with the admission policy, or
+	// insert every read miss if nil
+	SetAdmission(admission *TinyLFU)
+}
+
+// TinyLFU admission policy as described by Einziger, Friedman and
+// Manes in "TinyLFU: A Highly Efficient Cache Admission Policy",
+// ACM Transactions on Storage 2017.
+//
+// Each access is first recorded in the doorkeeper bloom filter,
+// and only counted in the count-min sketch once the doorkeeper has
+// already seen the key.  Blocks accessed once then never reach the
+// sketch.  After sample accesses every counter is halved and the
+// doorkeeper is cleared, so the frequencies follow the workload.
+// A read miss is only inserted if its estimated frequency is higher
+// than the one of the block the cache would evict for it.
+const (
+	tinylfuDepth      = 4
+	tinylfuMaxCount   = 15
+	tinylfuSampleSize = 10
+)
+
+type TinyLFU struct {
+	sketch     [tinylfuDepth][]uint8
+	doorkeeper []uint64
+	mask       uint64
+	dkmask     uint64
+	sample     uint64
+	additions  uint64
+	resets     int
+}
+
+// Smallest power of 2 which is at least n
+func powerOf2(n uint64) uint64 {
+	p := uint64(1)
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// The sample size and the sizes of the sketch and
+// doorkeeper are set from the number of cache blocks
+func NewTinyLFU(cachesize uint64) *TinyLFU {
+	godbc.Require(cachesize > 0)
+
+	t := &TinyLFU{}
+	width := powerOf2(cachesize)
+	if width < 64 {
+		width = 64
+	}
+	for i := range t.sketch {
+		t.sketch[i] = make([]uint8, width)
+	}
+	t.mask = width - 1
+	t.sample = tinylfuSampleSize * cachesize
+
+	// One bit for each access in a sample
+	bits := powerOf2(t.sample)
+	if bits < 64 {
+		bits = 64
+	}
+	t.doorkeeper = make([]uint64, bits/64)
+	t.dkmask = bits - 1
+
+	godbc.Ensure(t.sample > 0)
+
+	return t
+}
+
+func tinylfuHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Index i of a hash, mixed with the splitmix64 finalizer so
+// that every index depends on all the bits of the hash.  The
+// rows of the sketch use the first indexes and the doorkeeper
+// the next ones.
+func tinylfuIndex(h uint64, i int) uint64 {
+	z := h + uint64(i+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Counter of the key in row i of the sketch
+func (t *TinyLFU) counter(i int, h uint64) *uint8 {
+	return &t.sketch[i][tinylfuIndex(h, i)&t.mask]
+}
+
+func (t *TinyLFU) doorkeeperContains(h uint64) bool {
+	for i := 0; i < tinylfuDepth; i++ {
+		bit := tinylfuIndex(h, tinylfuDepth+i) & t.dkmask
+		if t.doorkeeper[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TinyLFU) doorkeeperAdd(h uint64) {
+	for i := 0; i < tinylfuDepth; i++ {
+		bit := tinylfuIndex(h, tinylfuDepth+i) & t.dkmask
+		t.doorkeeper[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Estimated number of accesses to the key in the current sample
+func (t *TinyLFU) Estimate(key string) int {
+	h := tinylfuHash(key)
+
+	count := uint8(tinylfuMaxCount)
+	for i := range t.sketch {
+		if c := *t.counter(i, h); c < count {
+			count = c
+		}
+	}
+
+	if t.doorkeeperContains(h) {
+		return int(count) + 1
+	}
+	return int(count)
+}
+
+// Number of times the counters were aged
+func (t *TinyLFU) Resets() int {
+	return t.resets
+}
+
+// Halve the counters and clear the doorkeeper
+func (t *TinyLFU) reset() {
+	for i := range t.sketch {
+		for j := range t.sketch[i] {
+			t.sketch[i][j] >>= 1
+		}
+	}
+	for i := range t.doorkeeper {
+		t.doorkeeper[i] = 0
+	}
+	t.additions /= 2
+	t.resets++
+}
+
+// Record an access to the key
+func (t *TinyLFU) record(key string) {
+	if t == nil {
+		return
+	}
+
+	h := tinylfuHash(key)
+	if !t.doorkeeperContains(h) {
+		t.doorkeeperAdd(h)
+	} else {
+		for i := range t.sketch {
+			if c := t.counter(i, h); *c < tinylfuMaxCount {
+				*c++
+			}
+		}
+	}
+
+	t.additions++
+	if t.additions >= t.sample {
+		t.reset()
+	}
+}
+
+// Whether a read miss of the key should be inserted.  victim
+// returns the key the cache would evict for it, or "" if the
+// cache has room.  The decision is counted in stats.
+func (t *TinyLFU) admit(key string, victim func() string, stats *CacheStats) bool {
+	if t == nil {
+		return true
+	}
+
+	v := victim()
+	if v == "" || t.Estimate(key) > t.Estimate(v) {
+		stats.admitted++
+		return true
+	}
+
+	stats.rejected++
+	return false
+}
@@ -0,0 +1,216 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestNewTinyLFU(t *testing.T) {
+	assert.Panics(t, func() {
+		NewTinyLFU(0)
+	})
+
+	f := NewTinyLFU(100)
+	assert.Equal(t, 128, len(f.sketch[0]))
+	assert.Equal(t, uint64(1000), f.sample)
+	assert.Equal(t, 16, len(f.doorkeeper))
+}
+
+func TestTinyLFUEstimate(t *testing.T) {
+	f := NewTinyLFU(100)
+	assert.Equal(t, 0, f.Estimate("a"))
+
+	// The first access only goes to the doorkeeper
+	f.record("a")
+	assert.Equal(t, 1, f.Estimate("a"))
+	assert.Equal(t, uint8(0), *f.counter(0, tinylfuHash("a")))
+
+	for i := 0; i < 3; i++ {
+		f.record("a")
+	}
+	assert.Equal(t, 4, f.Estimate("a"))
+
+	// Counters saturate
+	for i := 0; i < 100; i++ {
+		f.record("a")
+	}
+	assert.Equal(t, tinylfuMaxCount+1, f.Estimate("a"))
+}
+
+func TestTinyLFUReset(t *testing.T) {
+	f := NewTinyLFU(1)
+	assert.Equal(t, uint64(10), f.sample)
+
+	for i := 0; i < 9; i++ {
+		f.record("a")
+	}
+	assert.Equal(t, 9, f.Estimate("a"))
+	assert.Equal(t, 0, f.Resets())
+
+	// The sample is full: the counters are halved
+	// and the doorkeeper forgets the key
+	f.record("a")
+	assert.Equal(t, 1, f.Resets())
+	assert.Equal(t, 4, f.Estimate("a"))
+	assert.Equal(t, uint64(5), f.additions)
+}
+
+func TestTinyLFUAdmit(t *testing.T) {
+	c := NewLRUCache(2, false)
+	c.SetAdmission(NewTinyLFU(2))
+
+	// Admitted while there is room
+	c.Read("", "a")
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "b")
+	assert.Equal(t, 2, c.stats.admitted)
+
+	// Not seen more often than the victim a
+	assert.False(t, c.Read("", "c"))
+	assert.Equal(t, 1, c.stats.rejected)
+	_, ok := c.cachemap["c"]
+	assert.False(t, ok)
+	assert.Equal(t, 2, c.lru.Len())
+
+	c.Read("", "c")
+	assert.Equal(t, 2, c.stats.rejected)
+	assert.False(t, c.Read("", "c"))
+	assert.Equal(t, 3, c.stats.admitted)
+	assert.True(t, c.Read("", "c"))
+	_, ok = c.cachemap["a"]
+	assert.False(t, ok)
+
+	stats := c.Stats()
+	assert.Equal(t, 3, stats.Admitted())
+	assert.Equal(t, 2, stats.Rejected())
+	assert.Contains(t, stats.String(), "Admitted Inserts: 3\nRejected Inserts: 2\n")
+
+	// Without an admission policy every read miss is inserted
+	c = NewLRUCache(2, false)
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.Equal(t, 0, c.stats.admitted)
+	assert.Equal(t, 2, c.lru.Len())
+	assert.NotContains(t, c.Stats().String(), "Admitted")
+}
+
+func TestTinyLFUScan(t *testing.T) {
+	c := NewIoCache(10, false)
+	c.SetAdmission(NewTinyLFU(10))
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 10; j++ {
+			c.Read("", strconv.Itoa(j))
+		}
+	}
+
+	// Blocks read once do not push out the working set
+	for i := 100; i < 150; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	assert.Equal(t, 50, c.stats.rejected)
+	for j := 0; j < 10; j++ {
+		assert.True(t, c.Read("", strconv.Itoa(j)))
+	}
+}
+
+func TestTinyLFUStatsValues(t *testing.T) {
+	c := NewIoCache(10, false)
+	c.SetAdmission(NewTinyLFU(10))
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 10; j++ {
+			c.Read("", strconv.Itoa(j))
+		}
+	}
+	prev := c.Stats()
+	for i := 100; i < 150; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+
+	// Admitted and rejected inserts are in the metrics
+	// and the summaries
+	index := make(map[string]int)
+	for i, column := range CacheStatsColumns {
+		index[column] = i
+	}
+	assert.Equal(t, 10, c.Stats().Values()[index["admitted"]])
+	assert.Equal(t, 50, c.Stats().Values()[index["rejected"]])
+	assert.Equal(t, 0, c.Stats().DeltaValues(prev)[index["admitted"]])
+	assert.Equal(t, 50, c.Stats().DeltaValues(prev)[index["rejected"]])
+}
+
+func TestCacheVictims(t *testing.T) {
+	// IoCache CLOCK
+	blocks := NewIoCacheBlocks(2)
+	assert.Equal(t, "", blocks.victim())
+	blocks.Insert("a")
+	blocks.Insert("b")
+	assert.Equal(t, "a", blocks.victim())
+	blocks.Using(0)
+	assert.Equal(t, "b", blocks.victim())
+	blocks.Using(1)
+	assert.Equal(t, "a", blocks.victim())
+	evictkey, _, _, _ := blocks.Insert("c")
+	assert.Equal(t, "a", evictkey)
+
+	// Every other policy names the key its next insert evicts
+	simple := NewSimpleCache(5, false)
+	iocache := NewIoCache(5, false)
+	lru := NewLRUCache(5, false)
+	arc := NewARCCache(5, false)
+	twoq := NewTwoQCache(5, false, 25, 50)
+	slru := NewSLRUCache(5, false, 50)
+	lirs := NewLIRSCache(5, false, 25)
+	sieve := NewSIEVECache(5, false)
+	s3fifo := NewS3FIFOCache(5, false, 40)
+	clockpro := NewClockProCache(5, false)
+	for _, test := range []struct {
+		cache  Caches
+		victim func(key string) string
+	}{
+		{simple, func(string) string { return simple.victimKey() }},
+		{iocache, func(string) string { return iocache.victimKey() }},
+		{lru, func(string) string { return lru.victimKey() }},
+		{arc, arc.victimKey},
+		{twoq, func(string) string { return twoq.victimKey() }},
+		{slru, func(string) string { return slru.victimKey() }},
+		{lirs, func(string) string { return lirs.victimKey() }},
+		{sieve, func(string) string { return sieve.victimKey() }},
+		{s3fifo, func(string) string { return s3fifo.victimKey() }},
+		{clockpro, func(string) string { return clockpro.victimKey() }},
+	} {
+		c := test.cache
+		for _, key := range []string{"a", "b", "c", "a", "d", "b"} {
+			c.Read("", key)
+		}
+		assert.Equal(t, "", test.victim("e"))
+
+		for i := 0; i < 50; i++ {
+			key := strconv.Itoa(i * i % 7)
+			victim := test.victim(key)
+			evictions := c.Stats().evictions
+			if !c.Read("", key) && victim != "" {
+				assert.Equal(t, evictions+1, c.Stats().evictions)
+				assert.False(t, c.Read("", victim), victim)
+			}
+		}
+	}
+}
@@ -0,0 +1,386 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// Adaptive Replacement Cache as described by Megiddo and Modha in
+// "ARC: A Self-Tuning, Low Overhead Replacement Cache", FAST 2003.
+//
+// T1 holds keys seen once recently, T2 keys seen at least twice.
+// B1 and B2 are the ghost lists of keys evicted from T1 and T2.
+// Only T1 and T2 hold data.  Hits on the ghost lists move the
+// target size p of T1 up or down.
+
+const (
+	arcT1 = iota
+	arcT2
+	arcB1
+	arcB2
+)
+
+type arcEntry struct {
+	key  string
+	list int
+}
+
+type arcStats struct {
+	b1hits, b2hits int
+	pincreases     int
+	pdecreases     int
+	pmin, pmax     uint64
+	psum, psamples float64
+}
+
+type ARCCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	arcstats     *arcStats
+	cachemap     map[string]*list.Element
+	objects      *objectIndex
+	lists        [4]*list.List
+	p            uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+func NewARCCache(cachesize uint64, writethrough bool) *ARCCache {
+	godbc.Require(cachesize > 0)
+
+	cache := &ARCCache{}
+	cache.stats = NewCacheStats()
+	cache.arcstats = &arcStats{}
+	cache.cachemap = make(map[string]*list.Element)
+	cache.objects = newObjectIndex()
+	for i := range cache.lists {
+		cache.lists[i] = list.New()
+	}
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+
+	return cache
+}
+
+func (c *ARCCache) Close() {
+
+}
+
+func (c *ARCCache) len(l int) uint64 {
+	return uint64(c.lists[l].Len())
+}
+
+func (c *ARCCache) resident() uint64 {
+	return c.len(arcT1) + c.len(arcT2)
+}
+
+// Move an element to the MRU position of another list
+func (c *ARCCache) move(e *list.Element, to int) {
+	entry := e.Value.(*arcEntry)
+	c.lists[entry.list].Remove(e)
+	entry.list = to
+	c.cachemap[entry.key] = c.lists[to].PushFront(entry)
+}
+
+// Remove the LRU element of a list completely
+func (c *ARCCache) drop(l int) {
+	e := c.lists[l].Back()
+	delete(c.cachemap, e.Value.(*arcEntry).key)
+	c.lists[l].Remove(e)
+}
+
+// Evict the LRU of T1 or T2 into its ghost list
+func (c *ARCCache) replace(inb2 bool) {
+	c.stats.evictions++
+
+	if c.replaceFrom(c.p, inb2) == arcT1 {
+		c.evict(c.lists[arcT1].Back(), arcB1)
+	} else {
+		c.evict(c.lists[arcT2].Back(), arcB2)
+	}
+}
+
+// List replace evicts from with a target T1 size of p
+func (c *ARCCache) replaceFrom(p uint64, inb2 bool) int {
+	t1 := c.len(arcT1)
+	if t1 > 0 && ((inb2 && t1 == p) || t1 > p || c.len(arcT2) == 0) {
+		return arcT1
+	}
+	return arcT2
+}
+
+// Target T1 size after a hit on a ghost list
+func (c *ARCCache) adapt(ghost int) uint64 {
+	if ghost == arcB1 {
+		delta := uint64(1)
+		if c.len(arcB2) > c.len(arcB1) {
+			delta = c.len(arcB2) / c.len(arcB1)
+		}
+		if c.p+delta > c.cachesize {
+			return c.cachesize
+		}
+		return c.p + delta
+	}
+
+	delta := uint64(1)
+	if c.len(arcB1) > c.len(arcB2) {
+		delta = c.len(arcB1) / c.len(arcB2)
+	}
+	if delta > c.p {
+		return 0
+	}
+	return c.p - delta
+}
+
+// Move a resident element to a ghost list
+func (c *ARCCache) evict(e *list.Element, to int) {
+	c.stats.tenants.evict(e.Value.(*arcEntry).key)
+	c.objects.remove(e.Value.(*arcEntry).key)
+	c.move(e, to)
+}
+
+func (c *ARCCache) sample() {
+	s := c.arcstats
+	if s.psamples == 0 || c.p < s.pmin {
+		s.pmin = c.p
+	}
+	if c.p > s.pmax {
+		s.pmax = c.p
+	}
+	s.psum += float64(c.p)
+	s.psamples++
+}
+
+func (c *ARCCache) Invalidate(key string) {
+	if e, ok := c.cachemap[key]; ok {
+		entry := e.Value.(*arcEntry)
+		if entry.list == arcT1 || entry.list == arcT2 {
+			c.stats.writehits++
+			c.stats.tenants.writehit()
+			c.stats.invalidations++
+			c.stats.tenants.invalidate(key)
+			c.lists[entry.list].Remove(e)
+			c.objects.remove(key)
+			delete(c.cachemap, key)
+		}
+	}
+}
+
+// Insert a key which is not resident.  The key may be in
+// one of the ghost lists, in which case p is adapted.
+func (c *ARCCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		switch e.Value.(*arcEntry).list {
+		case arcB1:
+			c.arcstats.b1hits++
+			c.p = c.adapt(arcB1)
+			c.arcstats.pincreases++
+			if c.resident() >= c.cachesize {
+				c.replace(false)
+			}
+			c.move(e, arcT2)
+			return
+
+		case arcB2:
+			c.arcstats.b2hits++
+			c.p = c.adapt(arcB2)
+			c.arcstats.pdecreases++
+			if c.resident() >= c.cachesize {
+				c.replace(true)
+			}
+			c.move(e, arcT2)
+			return
+		}
+	}
+
+	// Not in any list
+	l1 := c.len(arcT1) + c.len(arcB1)
+	total := l1 + c.len(arcT2) + c.len(arcB2)
+	if l1 >= c.cachesize {
+		if c.len(arcT1) < c.cachesize {
+			c.drop(arcB1)
+			if c.resident() >= c.cachesize {
+				c.replace(false)
+			}
+		} else {
+			c.stats.evictions++
+			c.stats.tenants.evict(c.lists[arcT1].Back().Value.(*arcEntry).key)
+			c.objects.remove(c.lists[arcT1].Back().Value.(*arcEntry).key)
+			c.drop(arcT1)
+		}
+	} else if total >= c.cachesize {
+		if total >= 2*c.cachesize {
+			c.drop(arcB2)
+		}
+		if c.resident() >= c.cachesize {
+			c.replace(false)
+		}
+	}
+
+	c.cachemap[key] = c.lists[arcT1].PushFront(&arcEntry{key: key, list: arcT1})
+}
+
+func (c *ARCCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+	defer c.sample()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *ARCCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+	defer c.sample()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		list := e.Value.(*arcEntry).list
+		if list == arcT1 || list == arcT2 {
+			// Read Hit
+			c.stats.readhits++
+			c.stats.tenants.readhit()
+
+			// Seen at least twice now
+			c.move(e, arcT2)
+			return true
+		}
+	}
+
+	// Read miss
+	// We would do IO here
+	victim := func() string {
+		return c.victimKey(key)
+	}
+	if c.admission.admit(key, victim, c.stats) {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+	return false
+}
+
+// Free all the cached chunks of the object.  Their ghosts
+// are not kept, since the data no longer exists.
+func (c *ARCCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		e := c.cachemap[key]
+		c.stats.tenants.invalidate(key)
+		c.lists[e.Value.(*arcEntry).list].Remove(e)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *ARCCache) String() string {
+	s := c.arcstats
+	pmean := 0.0
+	if s.psamples > 0 {
+		pmean = s.psum / s.psamples
+	}
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"T1: %d T2: %d B1: %d B2: %d\n"+
+			"B1 Ghost Hits: %d\n"+
+			"B2 Ghost Hits: %d\n"+
+			"Target T1 Size (p): %d\n"+
+			"Target T1 Size Mean: %.2f Min: %d Max: %d\n"+
+			"Target T1 Size Increases: %d Decreases: %d\n",
+		float64(c.resident())/float64(c.cachesize)*100.0,
+		c.len(arcT1), c.len(arcT2), c.len(arcB1), c.len(arcB2),
+		s.b1hits,
+		s.b2hits,
+		c.p,
+		pmean, s.pmin, s.pmax,
+		s.pincreases, s.pdecreases) +
+		c.stats.String()
+}
+
+// The target size of T1 and the size of each list are
+// sampled with the stats for the metrics
+func (c *ARCCache) Stats() *CacheStats {
+	stats := c.stats.Copy()
+	stats.gauges = []CacheGauge{
+		{"arc_p", c.p},
+		{"arc_t1", c.len(arcT1)},
+		{"arc_t2", c.len(arcT2)},
+		{"arc_b1", c.len(arcB1)},
+		{"arc_b2", c.len(arcB2)},
+	}
+	return stats
+}
+
+func (c *ARCCache) StatsClear() {
+	c.stats.clear()
+	c.arcstats = &arcStats{}
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *ARCCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *ARCCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *ARCCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert of key, or "" if there is room
+func (c *ARCCache) victimKey(key string) string {
+	if c.resident() < c.cachesize {
+		return ""
+	}
+
+	// A ghost hit adapts p before replacing
+	p, inb2 := c.p, false
+	if e, ok := c.cachemap[key]; ok {
+		if ghost := e.Value.(*arcEntry).list; ghost == arcB1 || ghost == arcB2 {
+			p, inb2 = c.adapt(ghost), ghost == arcB2
+		}
+	}
+
+	return c.lists[c.replaceFrom(p, inb2)].Back().Value.(*arcEntry).key
+}
@@ -0,0 +1,193 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestNewARCCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewARCCache(0, false)
+	})
+
+	c := NewARCCache(uint64(100), true)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, uint64(0), c.p)
+	assert.True(t, c.writethrough)
+}
+
+func TestARCCachePromotion(t *testing.T) {
+	c := NewARCCache(4, false)
+
+	// First access goes to T1
+	assert.False(t, c.Read("", "a"))
+	assert.Equal(t, uint64(1), c.len(arcT1))
+
+	// Second access moves it to T2
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, uint64(0), c.len(arcT1))
+	assert.Equal(t, uint64(1), c.len(arcT2))
+	assert.Equal(t, 1, c.stats.readhits)
+}
+
+func TestARCCacheGhostHits(t *testing.T) {
+	c := NewARCCache(2, false)
+
+	// Without anything in T2, a full T1 drops its LRU entirely
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, uint64(0), c.len(arcB1))
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+
+	// Now put "c" in T2 and push "b" into B1
+	c = NewARCCache(2, false)
+	c.Read("", "c")
+	c.Read("", "c")
+	c.Read("", "b")
+	c.Read("", "d")
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, arcB1, c.cachemap["b"].Value.(*arcEntry).list)
+
+	// Ghost hit on B1 grows p and brings "b" back into T2,
+	// pushing the LRU of T2 into B2
+	assert.False(t, c.Read("", "b"))
+	assert.Equal(t, 1, c.arcstats.b1hits)
+	assert.Equal(t, uint64(1), c.p)
+	assert.Equal(t, arcT2, c.cachemap["b"].Value.(*arcEntry).list)
+	assert.Equal(t, arcB2, c.cachemap["c"].Value.(*arcEntry).list)
+	assert.Equal(t, uint64(2), c.resident())
+
+	// Ghost hit on B2 shrinks p
+	assert.False(t, c.Read("", "c"))
+	assert.Equal(t, 1, c.arcstats.b2hits)
+	assert.Equal(t, uint64(0), c.p)
+	assert.Equal(t, arcT2, c.cachemap["c"].Value.(*arcEntry).list)
+}
+
+func TestARCCacheMetrics(t *testing.T) {
+	var b bytes.Buffer
+	m := NewMetricsWriter(&b, "jsonl")
+	c := NewARCCache(2, false)
+
+	// p and the list sizes follow the ghost hits
+	// of TestARCCacheGhostHits
+	prev := c.Stats()
+	for _, key := range []string{"c", "c", "b", "d", "b"} {
+		c.Read("", key)
+	}
+	assert.NoError(t, m.Write(0, c.Stats(), prev))
+	prev = c.Stats()
+	c.Read("", "c")
+	assert.NoError(t, m.Write(1, c.Stats(), prev))
+	assert.NoError(t, m.Flush())
+
+	var rows []map[string]float64
+	dec := json.NewDecoder(&b)
+	for dec.More() {
+		var row map[string]float64
+		assert.NoError(t, dec.Decode(&row))
+		rows = append(rows, row)
+	}
+	assert.Equal(t, 2, len(rows))
+	assert.Equal(t, 1.0, rows[0]["arc_p"])
+	assert.Equal(t, 1.0, rows[0]["arc_t1"])
+	assert.Equal(t, 1.0, rows[0]["arc_t2"])
+	assert.Equal(t, 0.0, rows[0]["arc_b1"])
+	assert.Equal(t, 1.0, rows[0]["arc_b2"])
+	assert.Equal(t, 0.0, rows[1]["arc_p"])
+	assert.Equal(t, len(CacheStatsColumns)+6, len(rows[1]))
+
+	// Writes sample p like reads
+	c.Write("", "e")
+	assert.Equal(t, 7.0, float64(c.arcstats.psamples))
+}
+
+func TestARCCacheScanResistance(t *testing.T) {
+	c := NewARCCache(10, false)
+
+	// Build a frequently used working set
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			c.Read("", strconv.Itoa(j))
+		}
+	}
+
+	// A long scan should not flush it
+	for i := 100; i < 200; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	for j := 0; j < 5; j++ {
+		assert.True(t, c.Read("", strconv.Itoa(j)))
+	}
+	assert.True(t, c.resident() <= c.cachesize)
+	assert.True(t, c.resident()+c.len(arcB1)+c.len(arcB2) <= 2*c.cachesize)
+}
+
+func TestARCCacheInvalidate(t *testing.T) {
+	c := NewARCCache(2, true)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.len(arcT1))
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, uint64(1), c.resident())
+
+	c = NewARCCache(2, false)
+	c.Read("", "a")
+	c.Write("", "a")
+	assert.Equal(t, uint64(0), c.resident())
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestARCCacheDelete(t *testing.T) {
+	c := NewARCCache(2, false)
+
+	c.Read("a", "1")
+	c.Read("a", "1")
+	c.Read("b", "1")
+	assert.Equal(t, uint64(1), c.len(arcT1))
+	assert.Equal(t, uint64(1), c.len(arcT2))
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.len(arcT2))
+	assert.Equal(t, uint64(1), c.resident())
+
+	// Ghosts are not resident, so they are not deleted
+	c.Read("c", "1")
+	c.Read("c", "1")
+	c.Read("d", "1")
+	assert.Equal(t, uint64(1), c.len(arcB1))
+	c.Delete("b")
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(1), c.len(arcB1))
+
+	c.Delete("c")
+	c.Delete("d")
+	assert.Equal(t, uint64(0), c.resident())
+	assert.Equal(t, 0, len(c.objects.objs))
+}
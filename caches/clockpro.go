@@ -0,0 +1,462 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// CLOCK-Pro as described by Jiang, Chen and Zhang in "CLOCK-Pro: An
+// Effective Improvement of the CLOCK Replacement", USENIX ATC 2005.
+//
+// Each block is hot, cold, or a non-resident cold block still in
+// its test period, remembered after being evicted.  New blocks are
+// cold and go in the ring right behind the hot hand.  Three hands
+// move around the ring from older to newer slots:
+//
+//	cold: Evicts cold blocks not referenced since it last passed
+//	      them, keeping them as test blocks, and promotes the
+//	      referenced ones to hot.  It stops on the block it will
+//	      evict, so the victim is known before the insert.
+//	hot:  Demotes hot blocks not referenced since it last passed
+//	      them to cold while there are more hot blocks than the
+//	      cache size minus the cold target.
+//	test: Forgets test blocks while there are more than the
+//	      cache size of them.
+//
+// A miss on a test block makes it hot and grows the cold target,
+// and forgetting a test block shrinks it, so the number of cold
+// blocks adapts to the workload like the HIR blocks of LIRS.  The
+// cold target starts at its minimum, as in the paper.
+//
+// The ring is not the fixed array of IoCacheBlocks, where a new block
+// takes the slot of the block it evicts: test blocks need slots of
+// their own, and new blocks go behind the hot hand, not where the
+// cold hand evicts.  Instead the ring is a single slotQueues queue
+// like the one of SIEVE, with the freq of a slot as its reference bit.
+
+const (
+	clockProHot = iota
+	clockProCold
+	clockProTest
+)
+
+const clockProRing = 0
+
+type clockProStats struct {
+	promotions  int
+	demotions   int
+	testhits    int
+	testexpired int
+}
+
+type ClockProBlocks struct {
+	slots      *slotQueues
+	status     []int
+	tests      map[string]int
+	handhot    int
+	handcold   int
+	handtest   int
+	hot, cold  uint64
+	test       uint64
+	coldtarget uint64
+	size       uint64
+	stats      *clockProStats
+}
+
+func NewClockProBlocks(cachesize uint64) *ClockProBlocks {
+	godbc.Require(cachesize > 0)
+
+	// Room for the resident and the test blocks
+	c := &ClockProBlocks{}
+	c.slots = newSlotQueues(2*cachesize, 1)
+	c.status = make([]int, 2*cachesize)
+	c.tests = make(map[string]int)
+	c.handhot = noSlot
+	c.handcold = noSlot
+	c.handtest = noSlot
+	c.coldtarget = 1
+	c.size = cachesize
+	c.stats = &clockProStats{}
+
+	return c
+}
+
+// Slot after i in the direction of the hands, wrapping
+// from the newest block back to the oldest
+func (c *ClockProBlocks) advance(i int) int {
+	if i = c.slots.newer(i); i == noSlot {
+		i = c.slots.oldest(clockProRing)
+	}
+	return i
+}
+
+// Put a block in the ring right behind the hot hand
+func (c *ClockProBlocks) add(key string, status int) int {
+	var i int
+	if c.handhot == noSlot {
+		i = c.slots.push(clockProRing, key)
+		c.handhot = i
+		c.handcold = i
+		c.handtest = i
+	} else {
+		i = c.slots.pushBehind(c.handhot, key)
+	}
+	c.status[i] = status
+
+	return i
+}
+
+// Take a block out of the ring, moving the hands on it along
+func (c *ClockProBlocks) remove(i int) {
+	if c.slots.len(clockProRing) == 1 {
+		c.handhot = noSlot
+		c.handcold = noSlot
+		c.handtest = noSlot
+	} else {
+		next := c.advance(i)
+		if c.handhot == i {
+			c.handhot = next
+		}
+		if c.handcold == i {
+			c.handcold = next
+		}
+		if c.handtest == i {
+			c.handtest = next
+		}
+	}
+	c.slots.remove(i)
+}
+
+// Insert a block which is not resident, returning its slot
+// and the key of the block evicted for it, or "" if none was.
+// A test block becomes hot, any other block cold.
+func (c *ClockProBlocks) Insert(key string) (evictkey string, newindex int) {
+	status := clockProCold
+	if i, ok := c.tests[key]; ok {
+		c.stats.testhits++
+		c.stats.promotions++
+		if c.coldtarget < c.size {
+			c.coldtarget++
+		}
+		delete(c.tests, key)
+		c.test--
+		c.remove(i)
+		status = clockProHot
+	}
+
+	if c.hot+c.cold >= c.size {
+		evictkey = c.evict()
+	}
+
+	newindex = c.add(key, status)
+	if status == clockProHot {
+		c.hot++
+	} else {
+		c.cold++
+	}
+
+	return
+}
+
+// Run the hands until the cold hand is on a cold block not
+// referenced since it last passed it, which is the block the
+// next insert evicts.  Referenced cold blocks on the way are
+// promoted to hot, and the hot hand demotes hot blocks while
+// there are too many of them.
+func (c *ClockProBlocks) reclaim() int {
+	for {
+		i := c.handcold
+		if c.status[i] == clockProCold {
+			if c.slots.slots[i].freq == 0 {
+				return i
+			}
+			c.stats.promotions++
+			c.status[i] = clockProHot
+			c.slots.slots[i].freq = 0
+			c.cold--
+			c.hot++
+		}
+		c.handcold = c.advance(i)
+
+		for c.size-c.coldtarget < c.hot {
+			c.runHandHot()
+		}
+	}
+}
+
+// Evict the block at the cold hand, keeping it as a test
+// block, and return its key
+func (c *ClockProBlocks) evict() string {
+	i := c.reclaim()
+	key := c.slots.slots[i].key
+	c.status[i] = clockProTest
+	c.cold--
+	c.test++
+	c.tests[key] = i
+	c.handcold = c.advance(i)
+
+	for c.test > c.size {
+		c.runHandTest()
+	}
+
+	return key
+}
+
+// Demote the hot block at the hot hand if it was not referenced
+func (c *ClockProBlocks) runHandHot() {
+	if c.handhot == c.handtest {
+		c.runHandTest()
+	}
+
+	i := c.handhot
+	c.handhot = c.advance(i)
+
+	if c.status[i] == clockProHot {
+		if c.slots.slots[i].freq > 0 {
+			c.slots.slots[i].freq = 0
+		} else {
+			c.stats.demotions++
+			c.status[i] = clockProCold
+			c.hot--
+			c.cold++
+		}
+	}
+}
+
+// Forget the test block at the test hand
+func (c *ClockProBlocks) runHandTest() {
+	i := c.handtest
+	c.handtest = c.advance(i)
+
+	if c.status[i] == clockProTest {
+		c.stats.testexpired++
+		delete(c.tests, c.slots.slots[i].key)
+		c.test--
+		if c.coldtarget > 1 {
+			c.coldtarget--
+		}
+		c.remove(i)
+	}
+}
+
+// Key of the block the next Insert evicts, or "" if there is
+// room.  Like a background reclaim, the hands are run ahead of
+// the insert to leave the cold hand on that block.
+func (c *ClockProBlocks) victim() string {
+	if c.hot+c.cold < c.size {
+		return ""
+	}
+	return c.slots.slots[c.reclaim()].key
+}
+
+func (c *ClockProBlocks) Using(index int) {
+	c.slots.slots[index].freq = 1
+}
+
+// Remove a resident block from the ring
+func (c *ClockProBlocks) Free(index int) {
+	godbc.Require(c.status[index] != clockProTest)
+
+	if c.status[index] == clockProHot {
+		c.hot--
+	} else {
+		c.cold--
+	}
+	c.remove(index)
+}
+
+// Reset the counters of the hands.  The blocks and
+// the cold target are kept.
+func (c *ClockProBlocks) StatsClear() {
+	c.stats = &clockProStats{}
+}
+
+func (c *ClockProBlocks) String() string {
+	return fmt.Sprintf(
+		"Hot: %d Cold: %d Test: %d\n"+
+			"Cold Target: %d\n"+
+			"Promotions to Hot: %d\n"+
+			"Demotions to Cold: %d\n"+
+			"Test Hits: %d\n"+
+			"Test Periods Expired: %d\n",
+		c.hot, c.cold, c.test,
+		c.coldtarget,
+		c.stats.promotions,
+		c.stats.demotions,
+		c.stats.testhits,
+		c.stats.testexpired)
+}
+
+/* -------------------------------------------------------- */
+
+type ClockProCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]int
+	cachesize    uint64
+	writethrough bool
+	cacheblocks  *ClockProBlocks
+	objects      *objectIndex
+}
+
+func NewClockProCache(cachesize uint64, writethrough bool) *ClockProCache {
+	godbc.Require(cachesize > 0)
+
+	cache := &ClockProCache{}
+	cache.stats = NewCacheStats()
+	cache.cacheblocks = NewClockProBlocks(cachesize)
+	cache.cachemap = make(map[string]int)
+	cache.objects = newObjectIndex()
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+
+	return cache
+}
+
+func (c *ClockProCache) Close() {
+
+}
+
+func (c *ClockProCache) Invalidate(key string) {
+	if index, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.cacheblocks.Free(index)
+		c.objects.remove(key)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *ClockProCache) Insert(key string) {
+	c.stats.insertions++
+
+	evictkey, index := c.cacheblocks.Insert(key)
+
+	// Check for evictions
+	if evictkey != "" {
+		c.stats.evictions++
+		c.stats.tenants.evict(evictkey)
+		c.objects.remove(evictkey)
+		delete(c.cachemap, evictkey)
+	}
+
+	// Insert new key in cache map
+	c.cachemap[key] = index
+	c.stats.tenants.insert(key)
+}
+
+func (c *ClockProCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *ClockProCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if index, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		// Clock Algorithm: Set that we looked
+		// at it
+		c.cacheblocks.Using(index)
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
+		return false
+	}
+}
+
+// Free all the cached chunks of the object
+func (c *ClockProCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.cacheblocks.Free(c.cachemap[key])
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *ClockProCache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0) +
+		c.cacheblocks.String() +
+		c.stats.String()
+}
+
+func (c *ClockProCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *ClockProCache) StatsClear() {
+	c.stats.clear()
+	c.cacheblocks.StatsClear()
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *ClockProCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *ClockProCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *ClockProCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *ClockProCache) victimKey() string {
+	return c.cacheblocks.victim()
+}
@@ -0,0 +1,182 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestNewClockProCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewClockProCache(0, false)
+	})
+
+	c := NewClockProCache(uint64(100), true)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, 200, len(c.cacheblocks.slots.slots))
+	assert.Equal(t, uint64(1), c.cacheblocks.coldtarget)
+	assert.True(t, c.writethrough)
+}
+
+func TestClockProBlocks(t *testing.T) {
+	c := NewClockProBlocks(3)
+
+	for _, key := range []string{"a", "b", "c"} {
+		evictkey, _ := c.Insert(key)
+		assert.Equal(t, "", evictkey)
+	}
+	assert.Equal(t, uint64(3), c.cold)
+
+	// The cold hand promotes the referenced a, which stays hot
+	// since the cold target starts at its minimum.  b is evicted
+	// and kept as a test block.
+	c.Using(0)
+	evictkey, _ := c.Insert("d")
+	assert.Equal(t, "b", evictkey)
+	assert.Equal(t, 1, c.stats.promotions)
+	assert.Equal(t, 0, c.stats.demotions)
+	assert.Equal(t, uint64(1), c.hot)
+	assert.Equal(t, uint64(2), c.cold)
+	assert.Equal(t, uint64(1), c.test)
+	_, ok := c.tests["b"]
+	assert.True(t, ok)
+
+	// A miss on the test block b makes it hot and grows the
+	// cold target
+	evictkey, index := c.Insert("b")
+	assert.Equal(t, "c", evictkey)
+	assert.Equal(t, 1, c.stats.testhits)
+	assert.Equal(t, clockProHot, c.status[index])
+	assert.Equal(t, uint64(2), c.coldtarget)
+	assert.Equal(t, uint64(2), c.hot)
+	assert.Equal(t, uint64(1), c.cold)
+	assert.Equal(t, uint64(1), c.test)
+
+	// Test periods expire when there are too many test
+	// blocks, shrinking the cold target back to its minimum
+	for i := 0; i < 10; i++ {
+		c.Insert(strconv.Itoa(i))
+	}
+	assert.Equal(t, uint64(3), c.test)
+	assert.Equal(t, 1, c.stats.demotions)
+	assert.True(t, c.stats.testexpired > 0)
+	assert.Equal(t, uint64(1), c.coldtarget)
+	assert.Contains(t, c.String(), "Test Hits: 1")
+
+	c.StatsClear()
+	assert.Equal(t, 0, c.stats.testhits)
+}
+
+func TestClockProCacheLoop(t *testing.T) {
+	clockpro := NewClockProCache(10, false)
+	iocache := NewIoCache(10, false)
+
+	// A loop just larger than the cache defeats CLOCK
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 11; j++ {
+			clockpro.Read("", strconv.Itoa(j))
+			iocache.Read("", strconv.Itoa(j))
+		}
+	}
+	assert.Equal(t, 0, iocache.stats.readhits)
+	assert.True(t, clockpro.stats.readhits > 20)
+	assert.True(t, clockpro.cacheblocks.stats.testhits > 0)
+}
+
+func TestClockProCacheConsistency(t *testing.T) {
+	c := NewClockProCache(20, true)
+	r := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 10000; i++ {
+		obj := strconv.Itoa(r.Intn(4))
+		chunk := strconv.Itoa(int(r.ExpFloat64() * 20))
+		switch r.Intn(10) {
+		case 0:
+			c.Write(obj, chunk)
+		case 1:
+			c.Delete(obj)
+		default:
+			c.Read(obj, chunk)
+		}
+
+		b := c.cacheblocks
+		assert.True(t, b.hot+b.cold <= b.size)
+		assert.True(t, b.test <= b.size)
+		assert.Equal(t, uint64(len(c.cachemap)), b.hot+b.cold)
+		assert.Equal(t, uint64(len(b.tests)), b.test)
+	}
+	assert.True(t, c.stats.evictions > 0)
+	assert.True(t, c.cacheblocks.stats.testhits > 0)
+}
+
+func TestClockProCacheInvalidate(t *testing.T) {
+	c := NewClockProCache(2, true)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.cacheblocks.cold)
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, 1, len(c.cachemap))
+
+	c = NewClockProCache(2, false)
+	c.Read("", "a")
+	c.Write("", "a")
+	assert.Equal(t, uint64(0), c.cacheblocks.cold)
+	assert.Equal(t, noSlot, c.cacheblocks.handhot)
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestClockProBlocksVictim(t *testing.T) {
+	c := NewClockProBlocks(10)
+	r := rand.New(rand.NewSource(1))
+	resident := make(map[string]int)
+
+	// The victim is the block the insert evicts, even when the
+	// hot and test hands run first, and naming it again once the
+	// hands have run ahead changes nothing
+	for i := 0; i < 10000; i++ {
+		key := strconv.Itoa(int(r.ExpFloat64() * 15))
+		if index, ok := resident[key]; ok {
+			if r.Intn(20) == 0 {
+				c.Free(index)
+				delete(resident, key)
+			} else {
+				c.Using(index)
+			}
+			continue
+		}
+
+		victim := c.victim()
+		hands := []int{c.handhot, c.handcold, c.handtest}
+		counts := []uint64{c.hot, c.cold, c.test, c.coldtarget}
+		assert.Equal(t, victim, c.victim())
+		assert.Equal(t, hands, []int{c.handhot, c.handcold, c.handtest})
+		assert.Equal(t, counts, []uint64{c.hot, c.cold, c.test, c.coldtarget})
+
+		evictkey, index := c.Insert(key)
+		assert.Equal(t, victim, evictkey, key)
+		delete(resident, evictkey)
+		resident[key] = index
+	}
+	assert.True(t, c.stats.demotions > 0)
+	assert.True(t, c.stats.testhits > 0)
+	assert.True(t, c.stats.testexpired > 0)
+}
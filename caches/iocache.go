@@ -22,9 +22,10 @@ import (
 
 /* -------------------------------------------------------- */
 type IoCacheBlockInfo struct {
-	key  string
-	mru  bool
-	used bool
+	key   string
+	mru   bool
+	used  bool
+	dirty bool
 }
 
 type IoCacheBlocks struct {
@@ -40,7 +41,7 @@ func NewIoCacheBlocks(cachesize uint64) *IoCacheBlocks {
 	return icb
 }
 
-func (c *IoCacheBlocks) Insert(key string) (evictkey string, newindex uint64, err error) {
+func (c *IoCacheBlocks) Insert(key string) (evictkey string, evictdirty bool, newindex uint64, err error) {
 	for {
 		for ; c.index < c.size; c.index++ {
 			if c.cacheblocks[c.index].mru {
@@ -48,14 +49,17 @@ func (c *IoCacheBlocks) Insert(key string) (evictkey string, newindex uint64, er
 			} else {
 				if c.cacheblocks[c.index].used {
 					evictkey = c.cacheblocks[c.index].key
+					evictdirty = c.cacheblocks[c.index].dirty
 				} else {
 					evictkey = ""
+					evictdirty = false
 				}
 				newindex = c.index
 				err = nil
 				c.cacheblocks[c.index].key = key
 				c.cacheblocks[c.index].mru = false
 				c.cacheblocks[c.index].used = true
+				c.cacheblocks[c.index].dirty = false
 				c.index++
 				return
 			}
@@ -64,6 +68,21 @@ func (c *IoCacheBlocks) Insert(key string) (evictkey string, newindex uint64, er
 	}
 }
 
+// Key of the block Insert would evict, or "" if it
+// would use a free block
+func (c *IoCacheBlocks) victim() string {
+	for n := uint64(0); n < c.size; n++ {
+		block := c.cacheblocks[(c.index+n)%c.size]
+		if !block.mru {
+			return block.key
+		}
+	}
+
+	// Every block is marked, so Insert clears them all
+	// and comes back to the first one
+	return c.cacheblocks[c.index%c.size].key
+}
+
 func (c *IoCacheBlocks) Using(index uint64) {
 	c.cacheblocks[index].mru = true
 }
@@ -71,17 +90,80 @@ func (c *IoCacheBlocks) Using(index uint64) {
 func (c *IoCacheBlocks) Free(index uint64) {
 	c.cacheblocks[index].mru = false
 	c.cacheblocks[index].used = false
+	c.cacheblocks[index].dirty = false
 	c.cacheblocks[index].key = ""
 }
 
+func (c *IoCacheBlocks) SetDirty(index uint64) {
+	c.cacheblocks[index].dirty = true
+}
+
+func (c *IoCacheBlocks) ClearDirty(index uint64) {
+	c.cacheblocks[index].dirty = false
+}
+
+func (c *IoCacheBlocks) Dirty(index uint64) bool {
+	return c.cacheblocks[index].dirty
+}
+
+/* -------------------------------------------------------- */
+
+// Keys of the cached chunks of each object, so that
+// all the chunks of an object can be deleted
+type objectIndex struct {
+	chunks map[string]map[string]bool
+	objs   map[string]string
+}
+
+func newObjectIndex() *objectIndex {
+	return &objectIndex{
+		chunks: make(map[string]map[string]bool),
+		objs:   make(map[string]string),
+	}
+}
+
+func (o *objectIndex) add(obj, key string) {
+	if _, ok := o.chunks[obj]; !ok {
+		o.chunks[obj] = make(map[string]bool)
+	}
+	o.chunks[obj][key] = true
+	o.objs[key] = obj
+}
+
+// The chunk is no longer in the cache
+func (o *objectIndex) remove(key string) {
+	if obj, ok := o.objs[key]; ok {
+		delete(o.objs, key)
+		delete(o.chunks[obj], key)
+		if len(o.chunks[obj]) == 0 {
+			delete(o.chunks, obj)
+		}
+	}
+}
+
+// Forget the object, returning the keys of its cached chunks
+func (o *objectIndex) delete(obj string) []string {
+	keys := make([]string, 0, len(o.chunks[obj]))
+	for key := range o.chunks[obj] {
+		keys = append(keys, key)
+		delete(o.objs, key)
+	}
+	delete(o.chunks, obj)
+
+	return keys
+}
+
 /* -------------------------------------------------------- */
 
 type IoCache struct {
 	stats        *CacheStats
+	admission    *TinyLFU
 	cachemap     map[string]uint64
 	cachesize    uint64
 	writethrough bool
+	writeback    bool
 	cacheblocks  *IoCacheBlocks
+	objects      *objectIndex
 }
 
 func NewIoCache(cachesize uint64, writethrough bool) *IoCache {
@@ -91,6 +173,7 @@ func NewIoCache(cachesize uint64, writethrough bool) *IoCache {
 	cache.stats = NewCacheStats()
 	cache.cacheblocks = NewIoCacheBlocks(cachesize)
 	cache.cachemap = make(map[string]uint64)
+	cache.objects = newObjectIndex()
 	cache.cachesize = cachesize
 	cache.writethrough = writethrough
 
@@ -99,15 +182,39 @@ func NewIoCache(cachesize uint64, writethrough bool) *IoCache {
 	return cache
 }
 
-func (s *IoCache) Close() {
+// Write-back cache.  Writes are absorbed by the cache and only
+// sent to the backend when a dirty block is evicted or on Close().
+func NewIoCacheWriteBack(cachesize uint64) *IoCache {
+	cache := NewIoCache(cachesize, false)
+	cache.writeback = true
 
+	return cache
+}
+
+func (c *IoCache) Close() {
+	// Flush remaining dirty blocks
+	for index := uint64(0); index < c.cachesize; index++ {
+		if c.cacheblocks.Dirty(index) {
+			c.destage(index)
+		}
+	}
+}
+
+func (c *IoCache) destage(index uint64) {
+	// We would do back end IO here
+	c.stats.destages++
+	c.stats.dirty--
+	c.cacheblocks.ClearDirty(index)
 }
 
 func (c *IoCache) Invalidate(key string) {
 	if val, ok := c.cachemap[key]; ok {
 		c.stats.writehits++
+		c.stats.tenants.writehit()
 		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
 		c.cacheblocks.Free(val)
+		c.objects.remove(key)
 		delete(c.cachemap, key)
 	}
 }
@@ -115,22 +222,38 @@ func (c *IoCache) Invalidate(key string) {
 func (c *IoCache) Insert(key string) {
 	c.stats.insertions++
 
-	evictkey, index, _ := c.cacheblocks.Insert(key)
+	evictkey, evictdirty, index, _ := c.cacheblocks.Insert(key)
 
 	// Check for evictions
 	if evictkey != "" {
 		c.stats.evictions++
+		c.stats.tenants.evict(evictkey)
+		c.objects.remove(evictkey)
 		delete(c.cachemap, evictkey)
+
+		if evictdirty {
+			// We would do back end IO here
+			c.stats.destages++
+			c.stats.dirty--
+		}
 	}
 
 	// Insert new key in cache map
 	c.cachemap[key] = index
+	c.stats.tenants.insert(key)
 }
 
 func (c *IoCache) Write(obj, chunk string) {
 	c.stats.writes++
+	c.stats.tenants.write()
 
 	key := obj + chunk
+	c.admission.record(key)
+
+	if c.writeback {
+		c.writeBack(obj, key)
+		return
+	}
 
 	// Invalidate
 	c.Invalidate(key)
@@ -140,17 +263,42 @@ func (c *IoCache) Write(obj, chunk string) {
 	// Insert
 	if c.writethrough {
 		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *IoCache) writeBack(obj, key string) {
+	index, ok := c.cachemap[key]
+	if ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.cacheblocks.Using(index)
+	} else {
+		c.Insert(key)
+		c.objects.add(obj, key)
+		index = c.cachemap[key]
+	}
+
+	if c.cacheblocks.Dirty(index) {
+		// Overwrite of data not yet sent to the backend
+		c.stats.writeabsorptions++
+	} else {
+		c.stats.dirty++
+		c.cacheblocks.SetDirty(index)
 	}
 }
 
 func (c *IoCache) Read(obj, chunk string) bool {
 	c.stats.reads++
+	c.stats.tenants.read()
 
 	key := obj + chunk
+	c.admission.record(key)
 
 	if val, ok := c.cachemap[key]; ok {
 		// Read Hit
 		c.stats.readhits++
+		c.stats.tenants.readhit()
 
 		// Clock Algorithm: Set that we looked
 		// at it
@@ -159,13 +307,32 @@ func (c *IoCache) Read(obj, chunk string) bool {
 	} else {
 		// Read miss
 		// We would do IO here
-		c.Insert(key)
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
 		return false
 	}
 }
 
+// Free all the cached chunks of the object.  Dirty chunks
+// are dropped since the object no longer exists.
 func (c *IoCache) Delete(obj string) {
-	// Not supported
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		index := c.cachemap[key]
+		if c.cacheblocks.Dirty(index) {
+			c.stats.dirty--
+		}
+		c.stats.tenants.invalidate(key)
+		c.cacheblocks.Free(index)
+		delete(c.cachemap, key)
+	}
 }
 
 func (c *IoCache) String() string {
@@ -180,5 +347,27 @@ func (c *IoCache) Stats() *CacheStats {
 }
 
 func (c *IoCache) StatsClear() {
-	c.stats = NewCacheStats()
+	// Dirty blocks are still in the cache
+	dirty := c.stats.dirty
+	c.stats.clear()
+	c.stats.dirty = dirty
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *IoCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *IoCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *IoCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *IoCache) victimKey() string {
+	return c.cacheblocks.victim()
 }
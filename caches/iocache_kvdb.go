@@ -27,11 +27,13 @@ var buf []byte
 
 type IoCacheKvDB struct {
 	stats        *CacheStats
+	admission    *TinyLFU
 	cachemap     map[string]uint64
 	chunksize    uint32
 	cachesize    uint64
 	writethrough bool
 	cacheblocks  *IoCacheBlocks
+	objects      *objectIndex
 	db           kvdb.Kvdb
 }
 
@@ -43,6 +45,7 @@ func NewIoCacheKvDB(cachesize, bcsize uint64, writethrough bool, chunksize uint3
 	cache.stats = NewCacheStats()
 	cache.cacheblocks = NewIoCacheBlocks(cachesize)
 	cache.cachemap = make(map[string]uint64)
+	cache.objects = newObjectIndex()
 	cache.cachesize = cachesize
 	cache.chunksize = chunksize
 	cache.writethrough = writethrough
@@ -71,25 +74,35 @@ func (c *IoCacheKvDB) Close() {
 func (c *IoCacheKvDB) Invalidate(key string) {
 	if index, ok := c.cachemap[key]; ok {
 		c.stats.writehits++
+		c.stats.tenants.writehit()
 		c.stats.invalidations++
-		delete(c.cachemap, key)
-		c.cacheblocks.Free(index)
-
-		start := time.Now()
-		c.db.Delete([]byte(key), index)
-		end := time.Now()
-		c.stats.tdeletions.Add(end.Sub(start))
+		c.stats.tenants.invalidate(key)
+		c.remove(key, index)
 	}
 }
 
+// Remove the chunk from the cache and the db
+func (c *IoCacheKvDB) remove(key string, index uint64) {
+	delete(c.cachemap, key)
+	c.objects.remove(key)
+	c.cacheblocks.Free(index)
+
+	start := time.Now()
+	c.db.Delete([]byte(key), index)
+	end := time.Now()
+	c.stats.tdeletions.Add(end.Sub(start))
+}
+
 func (c *IoCacheKvDB) Insert(key string) {
 	c.stats.insertions++
 
-	evictkey, index, _ := c.cacheblocks.Insert(key)
+	evictkey, _, index, _ := c.cacheblocks.Insert(key)
 
 	// Check for evictions
 	if evictkey != "" {
 		c.stats.evictions++
+		c.stats.tenants.evict(evictkey)
+		c.objects.remove(evictkey)
 		delete(c.cachemap, evictkey)
 
 		start := time.Now()
@@ -100,6 +113,7 @@ func (c *IoCacheKvDB) Insert(key string) {
 
 	// Insert new key in cache map
 	c.cachemap[key] = index
+	c.stats.tenants.insert(key)
 
 	b := bufferio.NewBufferIO(buf)
 	b.Write([]byte(key))
@@ -113,8 +127,10 @@ func (c *IoCacheKvDB) Insert(key string) {
 
 func (c *IoCacheKvDB) Write(obj string, chunk string) {
 	c.stats.writes++
+	c.stats.tenants.write()
 
 	key := obj + chunk
+	c.admission.record(key)
 
 	// Invalidate
 	c.Invalidate(key)
@@ -124,17 +140,21 @@ func (c *IoCacheKvDB) Write(obj string, chunk string) {
 	// Insert
 	if c.writethrough {
 		c.Insert(key)
+		c.objects.add(obj, key)
 	}
 }
 
 func (c *IoCacheKvDB) Read(obj, chunk string) bool {
 	c.stats.reads++
+	c.stats.tenants.read()
 
 	key := obj + chunk
+	c.admission.record(key)
 
 	if index, ok := c.cachemap[key]; ok {
 		// Read Hit
 		c.stats.readhits++
+		c.stats.tenants.readhit()
 
 		// Allocate buffer
 		val := make([]byte, c.chunksize)
@@ -162,13 +182,27 @@ func (c *IoCacheKvDB) Read(obj, chunk string) bool {
 	} else {
 		// Read miss
 		// We would do IO here
-		c.Insert(key)
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
 		return false
 	}
 }
 
+// Remove all the cached chunks of the object
+// from the cache and the db
 func (c *IoCacheKvDB) Delete(obj string) {
-	// Not supported
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.remove(key, c.cachemap[key])
+	}
 }
 
 func (c *IoCacheKvDB) String() string {
@@ -179,10 +213,33 @@ func (c *IoCacheKvDB) String() string {
 		c.db.String()
 }
 
+func (c *IoCacheKvDB) DbStats() *kvdb.IoStats {
+	return c.db.Stats()
+}
+
 func (c *IoCacheKvDB) Stats() *CacheStats {
 	return c.stats.Copy()
 }
 
 func (c *IoCacheKvDB) StatsClear() {
-	c.stats = NewCacheStats()
+	c.stats.clear()
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *IoCacheKvDB) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *IoCacheKvDB) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *IoCacheKvDB) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *IoCacheKvDB) victimKey() string {
+	return c.cacheblocks.victim()
 }
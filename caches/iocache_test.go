@@ -148,3 +148,118 @@ func TestIoCacheInsert(t *testing.T) {
 	_, ok = c.cachemap["c"]
 	assert.True(t, ok)
 }
+
+func TestIoCacheWriteBack(t *testing.T) {
+	c := NewIoCacheWriteBack(2)
+	assert.True(t, c.writeback)
+	assert.False(t, c.writethrough)
+
+	// Write miss inserts a dirty block
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writes)
+	assert.Equal(t, 0, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.insertions)
+	assert.Equal(t, 1, c.stats.dirty)
+	index, ok := c.cachemap["a"]
+	assert.True(t, ok)
+	assert.True(t, c.cacheblocks.Dirty(index))
+
+	// Overwrite of a dirty block is absorbed
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.writeabsorptions)
+	assert.Equal(t, 1, c.stats.dirty)
+	assert.Equal(t, 0, c.stats.invalidations)
+
+	// Reads hit on dirty data
+	assert.True(t, c.Read("", "a"))
+
+	// Evicting a dirty block destages it
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, 0, c.stats.destages)
+	c.Read("", "d")
+	assert.Equal(t, 2, c.stats.evictions)
+	assert.Equal(t, 1, c.stats.destages)
+	assert.Equal(t, 0, c.stats.dirty)
+	_, ok = c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestIoCacheWriteBackClose(t *testing.T) {
+	c := NewIoCacheWriteBack(4)
+
+	c.Write("", "a")
+	c.Write("", "b")
+	c.Read("", "c")
+	assert.Equal(t, 2, c.stats.dirty)
+
+	// Dirty count survives clearing the stats
+	c.StatsClear()
+	assert.Equal(t, 2, c.stats.dirty)
+
+	c.Close()
+	assert.Equal(t, 2, c.stats.destages)
+	assert.Equal(t, 0, c.stats.dirty)
+	for index := uint64(0); index < c.cachesize; index++ {
+		assert.False(t, c.cacheblocks.Dirty(index))
+	}
+}
+
+func TestIoCacheDelete(t *testing.T) {
+	c := NewIoCache(4, true)
+
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Write("b", "1")
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	_, ok := c.cachemap["a1"]
+	assert.False(t, ok)
+	_, ok = c.cachemap["a2"]
+	assert.False(t, ok)
+	_, ok = c.cachemap["b1"]
+	assert.True(t, ok)
+	assert.False(t, c.cacheblocks.cacheblocks[0].used)
+	assert.False(t, c.cacheblocks.cacheblocks[1].used)
+	assert.True(t, c.cacheblocks.cacheblocks[2].used)
+
+	// Nothing left to delete
+	c.Delete("a")
+	assert.Equal(t, 2, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.False(t, c.Read("a", "1"))
+
+	// Evicted chunks are not deleted again
+	c = NewIoCache(2, true)
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Read("b", "1")
+	assert.Equal(t, 1, c.stats.evictions)
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, 1, len(c.cachemap))
+	_, ok = c.cachemap["b1"]
+	assert.True(t, ok)
+	c.Delete("b")
+	assert.Equal(t, 0, len(c.cachemap))
+	assert.Equal(t, 0, len(c.objects.objs))
+	assert.Equal(t, 0, len(c.objects.chunks))
+}
+
+func TestIoCacheWriteBackDelete(t *testing.T) {
+	c := NewIoCacheWriteBack(4)
+
+	c.Write("a", "1")
+	c.Write("a", "2")
+	assert.Equal(t, 2, c.stats.dirty)
+
+	// Deleted data is not destaged
+	c.Delete("a")
+	assert.Equal(t, 0, c.stats.dirty)
+	c.Close()
+	assert.Equal(t, 0, c.stats.destages)
+}
@@ -0,0 +1,373 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// LIRS cache as described by Jiang and Zhang in "LIRS: An Efficient
+// Low Inter-reference Recency Set Replacement Policy to Improve
+// Buffer Cache Performance", SIGMETRICS 2002.
+//
+// Blocks with a low inter-reference recency (LIR) use most of the
+// cache, and the rest holds resident blocks with a high one (HIR).
+// The stack S orders LIR blocks and recently seen HIR blocks by
+// recency, and always has a LIR block at its bottom.  The queue Q
+// holds the resident HIR blocks, and evictions come from it.  A HIR
+// block seen again while still in S becomes LIR, and the LIR block
+// at the bottom of S becomes HIR in exchange.  Non-resident HIR
+// blocks stay in S to remember their recency, up to the cache size.
+
+type lirsEntry struct {
+	key      string
+	lir      bool
+	resident bool
+	stack    *list.Element
+
+	// Element in Q, or in the ghost list when not resident
+	queue *list.Element
+}
+
+type lirsStats struct {
+	hirtolir, lirtohir int
+	ghosthits          int
+	prunes, pruned     int
+}
+
+type LIRSCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	lirsstats    *lirsStats
+	cachemap     map[string]*lirsEntry
+	objects      *objectIndex
+	stack        *list.List
+	queue        *list.List
+	ghosts       *list.List
+	lirs         uint64
+	lirsize      uint64
+	hirsize      uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+// hir is the % of the cache used by resident HIR blocks.  At
+// least one block is always kept for them.
+func NewLIRSCache(cachesize uint64,
+	writethrough bool,
+	hir int) *LIRSCache {
+
+	godbc.Require(cachesize > 1)
+	godbc.Require(0 < hir && hir < 100)
+
+	cache := &LIRSCache{}
+	cache.stats = NewCacheStats()
+	cache.lirsstats = &lirsStats{}
+	cache.cachemap = make(map[string]*lirsEntry)
+	cache.objects = newObjectIndex()
+	cache.stack = list.New()
+	cache.queue = list.New()
+	cache.ghosts = list.New()
+	cache.cachesize = cachesize
+	cache.hirsize = cachesize * uint64(hir) / 100
+	if cache.hirsize == 0 {
+		cache.hirsize = 1
+	}
+	cache.lirsize = cachesize - cache.hirsize
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.lirsize > 0)
+	godbc.Ensure(cache.hirsize > 0)
+	godbc.Ensure(cache.lirsize+cache.hirsize == cache.cachesize)
+
+	return cache
+}
+
+func (c *LIRSCache) Close() {
+
+}
+
+func (c *LIRSCache) resident() uint64 {
+	return c.lirs + uint64(c.queue.Len())
+}
+
+// Move an entry to the top of S
+func (c *LIRSCache) top(entry *lirsEntry) {
+	if entry.stack != nil {
+		c.stack.MoveToFront(entry.stack)
+	} else {
+		entry.stack = c.stack.PushFront(entry)
+	}
+}
+
+// Forget a non-resident HIR entry
+func (c *LIRSCache) forget(e *list.Element) {
+	entry := e.Value.(*lirsEntry)
+	c.ghosts.Remove(e)
+	c.stack.Remove(entry.stack)
+	delete(c.cachemap, entry.key)
+}
+
+// Remove the HIR entries at the bottom of S until it is a LIR entry
+func (c *LIRSCache) prune() {
+	pruned := 0
+	for e := c.stack.Back(); e != nil && !e.Value.(*lirsEntry).lir; e = c.stack.Back() {
+		entry := e.Value.(*lirsEntry)
+		if entry.resident {
+			c.stack.Remove(e)
+			entry.stack = nil
+		} else {
+			c.ghosts.Remove(entry.queue)
+			c.stack.Remove(e)
+			delete(c.cachemap, entry.key)
+		}
+		pruned++
+	}
+	if pruned > 0 {
+		c.lirsstats.prunes++
+		c.lirsstats.pruned += pruned
+	}
+}
+
+// Make the LIR entry at the bottom of S a resident HIR entry
+func (c *LIRSCache) demote() {
+	e := c.stack.Back()
+	entry := e.Value.(*lirsEntry)
+	godbc.Check(entry.lir)
+
+	c.lirsstats.lirtohir++
+	c.lirs--
+	entry.lir = false
+	c.stack.Remove(e)
+	entry.stack = nil
+	entry.queue = c.queue.PushFront(entry)
+	c.prune()
+}
+
+// Make an entry in S a LIR entry
+func (c *LIRSCache) promote(entry *lirsEntry) {
+	c.lirsstats.hirtolir++
+	c.lirs++
+	entry.lir = true
+	c.top(entry)
+	if c.lirs > c.lirsize {
+		c.demote()
+	}
+}
+
+// Evict the oldest resident HIR entry.  It is remembered
+// as a non-resident entry if it is still in S.
+func (c *LIRSCache) evict() {
+	c.stats.evictions++
+
+	e := c.queue.Back()
+	entry := e.Value.(*lirsEntry)
+	c.stats.tenants.evict(entry.key)
+	c.objects.remove(entry.key)
+	c.queue.Remove(e)
+	entry.resident = false
+	if entry.stack != nil {
+		entry.queue = c.ghosts.PushFront(entry)
+	} else {
+		delete(c.cachemap, entry.key)
+	}
+}
+
+func (c *LIRSCache) Invalidate(key string) {
+	if entry, ok := c.cachemap[key]; ok && entry.resident {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.remove(entry)
+		c.prune()
+	}
+}
+
+// Remove a resident entry completely.  S must be pruned after.
+func (c *LIRSCache) remove(entry *lirsEntry) {
+	if entry.lir {
+		c.lirs--
+	} else {
+		c.queue.Remove(entry.queue)
+	}
+	if entry.stack != nil {
+		c.stack.Remove(entry.stack)
+	}
+	c.objects.remove(entry.key)
+	delete(c.cachemap, entry.key)
+}
+
+// Insert a key which is not resident.  A non-resident
+// HIR entry still in S becomes a LIR entry.
+func (c *LIRSCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if c.resident() >= c.cachesize {
+		c.evict()
+	}
+
+	if entry, ok := c.cachemap[key]; ok {
+		c.lirsstats.ghosthits++
+		c.ghosts.Remove(entry.queue)
+		entry.queue = nil
+		entry.resident = true
+		c.promote(entry)
+	} else {
+		entry := &lirsEntry{key: key, resident: true}
+		c.cachemap[key] = entry
+		if c.lirs < c.lirsize {
+			// Until the LIR blocks fill their part of the cache
+			c.lirs++
+			entry.lir = true
+			c.top(entry)
+		} else {
+			c.top(entry)
+			entry.queue = c.queue.PushFront(entry)
+		}
+	}
+
+	for uint64(c.ghosts.Len()) > c.cachesize {
+		c.forget(c.ghosts.Back())
+	}
+	c.prune()
+}
+
+func (c *LIRSCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *LIRSCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if entry, ok := c.cachemap[key]; ok && entry.resident {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		if entry.lir {
+			c.top(entry)
+			c.prune()
+		} else if entry.stack != nil {
+			// Seen again within the recency of the LIR blocks
+			c.queue.Remove(entry.queue)
+			entry.queue = nil
+			c.promote(entry)
+		} else {
+			c.top(entry)
+			c.queue.MoveToFront(entry.queue)
+			c.prune()
+		}
+		return true
+	}
+
+	// Read miss
+	// We would do IO here
+	if c.admission.admit(key, c.victimKey, c.stats) {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+	return false
+}
+
+// Free all the cached chunks of the object.  Non-resident
+// entries of the object are not cached, so they are kept.
+func (c *LIRSCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.remove(c.cachemap[key])
+	}
+	c.prune()
+}
+
+func (c *LIRSCache) String() string {
+	s := c.lirsstats
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"LIR: %d Resident HIR: %d Non-resident HIR: %d\n"+
+			"LIR Size: %d HIR Size: %d\n"+
+			"HIR to LIR: %d\n"+
+			"LIR to HIR: %d\n"+
+			"Non-resident HIR Hits: %d\n"+
+			"Stack Prunes: %d Pruned Entries: %d\n",
+		float64(c.resident())/float64(c.cachesize)*100.0,
+		c.lirs, c.queue.Len(), c.ghosts.Len(),
+		c.lirsize, c.hirsize,
+		s.hirtolir,
+		s.lirtohir,
+		s.ghosthits,
+		s.prunes, s.pruned) +
+		c.stats.String()
+}
+
+func (c *LIRSCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *LIRSCache) StatsClear() {
+	c.stats.clear()
+	c.lirsstats = &lirsStats{}
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *LIRSCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *LIRSCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *LIRSCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *LIRSCache) victimKey() string {
+	if c.resident() < c.cachesize {
+		return ""
+	}
+	return c.queue.Back().Value.(*lirsEntry).key
+}
@@ -0,0 +1,208 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestNewLIRSCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewLIRSCache(1, false, 1)
+	})
+	assert.Panics(t, func() {
+		NewLIRSCache(100, false, 100)
+	})
+
+	c := NewLIRSCache(uint64(100), true, 10)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, uint64(90), c.lirsize)
+	assert.Equal(t, uint64(10), c.hirsize)
+	assert.True(t, c.writethrough)
+
+	// HIR blocks always get at least one block
+	c = NewLIRSCache(uint64(10), true, 1)
+	assert.Equal(t, uint64(9), c.lirsize)
+	assert.Equal(t, uint64(1), c.hirsize)
+}
+
+func TestLIRSCacheTransitions(t *testing.T) {
+	c := NewLIRSCache(4, false, 25)
+
+	// The first blocks fill the LIR part of the cache
+	for _, key := range []string{"a", "b", "c"} {
+		assert.False(t, c.Read("", key))
+		assert.True(t, c.cachemap[key].lir)
+	}
+
+	// Then blocks are resident HIR
+	c.Read("", "d")
+	assert.False(t, c.cachemap["d"].lir)
+	assert.Equal(t, 1, c.queue.Len())
+
+	// Evicting d keeps it in S as a non-resident HIR block
+	c.Read("", "e")
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.False(t, c.cachemap["d"].resident)
+	assert.Equal(t, 1, c.ghosts.Len())
+
+	// Seen again while in S, d becomes LIR and the LIR
+	// block at the bottom of S, a, becomes HIR
+	assert.False(t, c.Read("", "d"))
+	assert.Equal(t, 2, c.stats.evictions)
+	assert.Equal(t, 1, c.lirsstats.ghosthits)
+	assert.Equal(t, 1, c.lirsstats.hirtolir)
+	assert.Equal(t, 1, c.lirsstats.lirtohir)
+	assert.True(t, c.cachemap["d"].lir)
+	assert.False(t, c.cachemap["a"].lir)
+	assert.Nil(t, c.cachemap["a"].stack)
+	assert.Equal(t, uint64(3), c.lirs)
+	assert.Equal(t, uint64(4), c.resident())
+
+	// A hit on a HIR block which is not in S keeps it HIR
+	assert.True(t, c.Read("", "a"))
+	assert.False(t, c.cachemap["a"].lir)
+	assert.NotNil(t, c.cachemap["a"].stack)
+
+	// Moving the bottom LIR blocks up prunes the
+	// non-resident e from the bottom of S
+	assert.True(t, c.Read("", "b"))
+	assert.Equal(t, 0, c.lirsstats.prunes)
+	assert.True(t, c.Read("", "c"))
+	assert.Equal(t, 1, c.lirsstats.prunes)
+	assert.Equal(t, 1, c.lirsstats.pruned)
+	assert.Equal(t, 0, c.ghosts.Len())
+	_, ok := c.cachemap["e"]
+	assert.False(t, ok)
+	assert.True(t, c.stack.Back().Value.(*lirsEntry).lir)
+
+	assert.Contains(t, c.String(), "HIR to LIR: 1")
+	assert.Contains(t, c.String(), "Stack Prunes: 1 Pruned Entries: 1")
+
+	c.StatsClear()
+	assert.Equal(t, 0, c.lirsstats.hirtolir)
+}
+
+func TestLIRSCacheScanResistance(t *testing.T) {
+	c := NewLIRSCache(10, false, 10)
+
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 5; j++ {
+			c.Read("", strconv.Itoa(j))
+		}
+	}
+
+	// A long scan only passes through the resident HIR blocks
+	for i := 100; i < 200; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	for j := 0; j < 5; j++ {
+		assert.True(t, c.Read("", strconv.Itoa(j)))
+	}
+	assert.True(t, c.resident() <= c.cachesize)
+	assert.True(t, uint64(c.ghosts.Len()) <= c.cachesize)
+}
+
+func TestLIRSCacheLoop(t *testing.T) {
+	lirs := NewLIRSCache(10, false, 10)
+	lru := NewLRUCache(10, false)
+
+	// A loop just larger than the cache defeats LRU
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 11; j++ {
+			lirs.Read("", strconv.Itoa(j))
+			lru.Read("", strconv.Itoa(j))
+		}
+	}
+	assert.Equal(t, 0, lru.stats.readhits)
+	assert.True(t, lirs.stats.readhits > 70)
+}
+
+func TestLIRSCacheInvalidate(t *testing.T) {
+	c := NewLIRSCache(2, true, 50)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.lirs)
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, uint64(1), c.resident())
+
+	c = NewLIRSCache(2, false, 50)
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Write("", "a")
+	c.Write("", "b")
+	assert.Equal(t, uint64(0), c.resident())
+	assert.Equal(t, 0, c.stack.Len())
+	assert.Equal(t, 0, len(c.cachemap))
+}
+
+func TestLIRSCacheDelete(t *testing.T) {
+	c := NewLIRSCache(4, false, 25)
+
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Read("b", "1")
+	c.Read("b", "2")
+	c.Read("c", "1")
+	assert.Equal(t, uint64(3), c.lirs)
+	assert.Equal(t, 1, c.ghosts.Len())
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(1), c.lirs)
+	assert.Equal(t, uint64(2), c.resident())
+
+	// The non-resident entry of b is pruned with the
+	// LIR entry below it, but it is not a deletion hit
+	c.Delete("b")
+	assert.Equal(t, 2, c.stats.deletionhits)
+	assert.Equal(t, 0, c.stack.Len())
+	assert.Equal(t, 0, c.ghosts.Len())
+	assert.Equal(t, uint64(1), c.resident())
+	assert.True(t, c.Read("c", "1"))
+
+	// Random requests keep the entries consistent
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		obj := strconv.Itoa(r.Intn(5))
+		switch r.Intn(10) {
+		case 0:
+			c.Delete(obj)
+		case 1:
+			c.Write(obj, strconv.Itoa(r.Intn(4)))
+		default:
+			c.Read(obj, strconv.Itoa(r.Intn(4)))
+		}
+
+		assert.True(t, c.resident() <= c.cachesize)
+		resident := 0
+		for key, entry := range c.cachemap {
+			if entry.resident {
+				resident++
+				_, ok := c.objects.objs[key]
+				assert.True(t, ok)
+			}
+		}
+		assert.Equal(t, uint64(resident), c.resident())
+		assert.Equal(t, resident, len(c.objects.objs))
+	}
+}
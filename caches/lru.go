@@ -0,0 +1,184 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// True LRU.  The most recently used key is kept at the
+// front of the list, and evictions are taken from the back.
+type LRUCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]*list.Element
+	objects      *objectIndex
+	lru          *list.List
+	cachesize    uint64
+	writethrough bool
+}
+
+func NewLRUCache(cachesize uint64, writethrough bool) *LRUCache {
+	godbc.Require(cachesize > 0)
+
+	cache := &LRUCache{}
+	cache.stats = NewCacheStats()
+	cache.cachemap = make(map[string]*list.Element)
+	cache.objects = newObjectIndex()
+	cache.lru = list.New()
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+
+	return cache
+}
+
+func (c *LRUCache) Close() {
+
+}
+
+func (c *LRUCache) Invalidate(key string) {
+	if e, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.lru.Remove(e)
+		c.objects.remove(key)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *LRUCache) Evict() {
+	c.stats.evictions++
+
+	e := c.lru.Back()
+	c.stats.tenants.evict(e.Value.(string))
+	c.objects.remove(e.Value.(string))
+	delete(c.cachemap, e.Value.(string))
+	c.lru.Remove(e)
+}
+
+func (c *LRUCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if uint64(c.lru.Len()) >= c.cachesize {
+		c.Evict()
+	}
+
+	c.cachemap[key] = c.lru.PushFront(key)
+}
+
+func (c *LRUCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *LRUCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		// Move to most recently used
+		c.lru.MoveToFront(e)
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
+		return false
+	}
+}
+
+// Free all the cached chunks of the object
+func (c *LRUCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.lru.Remove(c.cachemap[key])
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *LRUCache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0) +
+		c.stats.String()
+}
+
+func (c *LRUCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *LRUCache) StatsClear() {
+	c.stats.clear()
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *LRUCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *LRUCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *LRUCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *LRUCache) victimKey() string {
+	if uint64(c.lru.Len()) < c.cachesize {
+		return ""
+	}
+	return c.lru.Back().Value.(string)
+}
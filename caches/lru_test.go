@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewLRUCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewLRUCache(0, false)
+	})
+
+	c := NewLRUCache(uint64(100), true)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.True(t, c.writethrough)
+
+	c = NewLRUCache(uint64(200), false)
+	assert.Equal(t, uint64(200), c.cachesize)
+	assert.False(t, c.writethrough)
+}
+
+func TestLRUCacheInvalidate(t *testing.T) {
+	c := NewLRUCache(100, true)
+
+	// Invalidate with nothing there
+	c.Invalidate("test")
+	assert.Equal(t, 0, c.stats.writehits)
+	assert.Equal(t, 0, c.stats.invalidations)
+
+	// Now insert the key and invalidate
+	c.Insert("test")
+	c.Invalidate("test")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	_, ok := c.cachemap["test"]
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.lru.Len())
+}
+
+func TestLRUCacheEvictions(t *testing.T) {
+	c := NewLRUCache(2, true)
+
+	c.Insert("key1")
+	c.Insert("key2")
+	assert.Equal(t, 0, c.stats.evictions)
+
+	// key1 is the least recently used
+	c.Insert("key3")
+	assert.Equal(t, 1, c.stats.evictions)
+	_, ok := c.cachemap["key1"]
+	assert.False(t, ok)
+
+	// Touch key2 so that key3 becomes the LRU
+	assert.True(t, c.Read("", "key2"))
+	c.Insert("key4")
+	assert.Equal(t, 2, c.stats.evictions)
+	_, ok = c.cachemap["key3"]
+	assert.False(t, ok)
+	_, ok = c.cachemap["key2"]
+	assert.True(t, ok)
+	_, ok = c.cachemap["key4"]
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.lru.Len())
+}
+
+func TestLRUCacheWrite(t *testing.T) {
+	c := NewLRUCache(2, false)
+
+	// Write around does not insert
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writes)
+	assert.Equal(t, 0, c.stats.insertions)
+	assert.False(t, c.Read("", "a"))
+	assert.True(t, c.Read("", "a"))
+
+	// Write invalidates
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+
+	// Writethrough inserts
+	c = NewLRUCache(2, true)
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.insertions)
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, 1, c.stats.readhits)
+}
+
+func TestLRUCacheDelete(t *testing.T) {
+	c := NewLRUCache(3, true)
+
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Write("b", "1")
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, 1, c.lru.Len())
+	assert.False(t, c.Read("a", "1"))
+	assert.True(t, c.Read("b", "1"))
+
+	c.Delete("c")
+	assert.Equal(t, 2, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+
+	// Evicted chunks are not deleted again
+	c.Read("c", "1")
+	c.Read("c", "2")
+	assert.Equal(t, 1, c.stats.evictions)
+	c.Delete("a")
+	c.Delete("b")
+	c.Delete("c")
+	assert.Equal(t, 0, c.lru.Len())
+	assert.Equal(t, 0, len(c.cachemap))
+	assert.Equal(t, 0, len(c.objects.objs))
+}
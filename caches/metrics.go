@@ -0,0 +1,134 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"io"
+	"strings"
+)
+
+// Writes periodic cache stats as rows of CacheStatsColumns
+// prefixed by the io number, followed by the TenantColumns
+// when the cache tracks its tenants and by the gauges of the
+// cache type, if it has any.  Supported formats are
+// csv, tsv and jsonl.  CSV and TSV files start with a header row.
+type MetricsWriter struct {
+	w       *bufio.Writer
+	format  string
+	columns []string
+	header  bool
+	rows    int
+}
+
+func NewMetricsWriter(w io.Writer, format string) *MetricsWriter {
+	return NewTableWriter(w, format, append([]string{"io"}, CacheStatsColumns...))
+}
+
+// Same as NewMetricsWriter, but with any set of columns.
+// Rows are written with WriteRow.
+func NewTableWriter(w io.Writer, format string, columns []string) *MetricsWriter {
+	godbc.Require(format == "csv" || format == "tsv" || format == "jsonl",
+		"Unknown metrics format", format)
+	godbc.Require(len(columns) > 0)
+
+	m := &MetricsWriter{}
+	m.w = bufio.NewWriter(w)
+	m.format = format
+	m.columns = columns
+
+	return m
+}
+
+func (m *MetricsWriter) separator() string {
+	if m.format == "tsv" {
+		return "\t"
+	}
+	return ","
+}
+
+func (m *MetricsWriter) writeRow(values []interface{}) error {
+	if m.format == "jsonl" {
+		var b bytes.Buffer
+		b.WriteString("{")
+		for i, v := range values {
+			jv, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "%q:%s", m.columns[i], jv)
+		}
+		b.WriteString("}\n")
+		_, err := m.w.Write(b.Bytes())
+		return err
+	}
+
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = fmt.Sprint(v)
+	}
+	_, err := m.w.WriteString(strings.Join(fields, m.separator()) + "\n")
+	return err
+}
+
+// Write one row with a value for each column
+func (m *MetricsWriter) WriteRow(values []interface{}) error {
+	godbc.Require(len(values) == len(m.columns))
+
+	if !m.header && m.format != "jsonl" {
+		m.header = true
+		_, err := m.w.WriteString(strings.Join(m.columns, m.separator()) + "\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	m.rows++
+	return m.writeRow(values)
+}
+
+// Write the stats collected since prev at io number ios
+func (m *MetricsWriter) Write(ios int, stats, prev *CacheStats) error {
+	values := append([]interface{}{ios}, stats.DeltaValues(prev)...)
+
+	// The tenants are known once the first row is written
+	tenants := stats.TenantDeltaValues(prev)
+	if m.rows == 0 && len(tenants) > 0 {
+		m.columns = append(m.columns, TenantColumns(len(stats.Tenants()))...)
+	}
+	values = append(values, tenants...)
+
+	// Gauges are sampled, not counted since prev
+	for _, g := range stats.Gauges() {
+		if m.rows == 0 {
+			m.columns = append(m.columns, g.Name)
+		}
+		values = append(values, g.Value)
+	}
+
+	return m.WriteRow(values)
+}
+
+func (m *MetricsWriter) Flush() error {
+	return m.w.Flush()
+}
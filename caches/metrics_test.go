@@ -0,0 +1,123 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func metricsTestStats() (*CacheStats, *CacheStats) {
+	c := NewLRUCache(10, true)
+	prev := c.Stats()
+	c.Write("", "a")
+	c.Read("", "a")
+	c.Read("", "b")
+	return c.Stats(), prev
+}
+
+func TestNewMetricsWriter(t *testing.T) {
+	var b bytes.Buffer
+	assert.Panics(t, func() {
+		NewMetricsWriter(&b, "xml")
+	})
+}
+
+func TestMetricsWriterCsv(t *testing.T) {
+	var b bytes.Buffer
+	stats, prev := metricsTestStats()
+
+	m := NewMetricsWriter(&b, "csv")
+	assert.NoError(t, m.Write(0, stats, prev))
+	assert.NoError(t, m.Write(1000, stats, stats))
+	assert.NoError(t, m.Flush())
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+
+	// Header is written once and matches the number of values
+	header := strings.Split(lines[0], ",")
+	assert.Equal(t, "io", header[0])
+	assert.Equal(t, "read_hit_rate", header[1])
+	assert.Equal(t, len(CacheStatsColumns)+1, len(header))
+
+	row := strings.Split(lines[1], ",")
+	assert.Equal(t, len(header), len(row))
+	assert.Equal(t, "0", row[0])
+	assert.Equal(t, "0.5", row[1])
+	assert.Equal(t, "2", row[6])
+
+	row = strings.Split(lines[2], ",")
+	assert.Equal(t, "1000", row[0])
+	assert.Equal(t, "0", row[6])
+}
+
+func TestMetricsWriterTsv(t *testing.T) {
+	var b bytes.Buffer
+	stats, prev := metricsTestStats()
+
+	m := NewMetricsWriter(&b, "tsv")
+	assert.NoError(t, m.Write(0, stats, prev))
+	assert.NoError(t, m.Flush())
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.Equal(t, len(CacheStatsColumns)+1, len(strings.Split(lines[0], "\t")))
+	assert.Equal(t, len(CacheStatsColumns)+1, len(strings.Split(lines[1], "\t")))
+}
+
+func TestMetricsWriterJsonl(t *testing.T) {
+	var b bytes.Buffer
+	stats, prev := metricsTestStats()
+
+	m := NewMetricsWriter(&b, "jsonl")
+	assert.NoError(t, m.Write(0, stats, prev))
+	assert.NoError(t, m.Write(1000, stats, prev))
+	assert.NoError(t, m.Flush())
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+
+	var row map[string]float64
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &row))
+	assert.Equal(t, len(CacheStatsColumns)+1, len(row))
+	assert.Equal(t, 1000.0, row["io"])
+	assert.Equal(t, 0.5, row["read_hit_rate"])
+	assert.Equal(t, 2.0, row["reads"])
+	assert.Equal(t, 1.0, row["writes"])
+}
+
+func TestTableWriter(t *testing.T) {
+	var b bytes.Buffer
+
+	m := NewTableWriter(&b, "csv", []string{"cachetype", "cachesize"})
+	assert.Panics(t, func() {
+		m.WriteRow([]interface{}{"lru"})
+	})
+	assert.NoError(t, m.WriteRow([]interface{}{"lru", 8}))
+	assert.NoError(t, m.WriteRow([]interface{}{"arc", 16}))
+	assert.NoError(t, m.Flush())
+	assert.Equal(t, "cachetype,cachesize\nlru,8\narc,16\n", b.String())
+
+	b.Reset()
+	m = NewTableWriter(&b, "jsonl", []string{"cachetype", "cachesize"})
+	assert.NoError(t, m.WriteRow([]interface{}{"lru", 8}))
+	assert.NoError(t, m.Flush())
+	assert.Equal(t, "{\"cachetype\":\"lru\",\"cachesize\":8}\n", b.String())
+}
@@ -43,10 +43,12 @@ func (c *NullCache) Insert(chunkkey string) {
 
 func (c *NullCache) Write(obj, chunk string) {
 	c.stats.writes++
+	c.stats.tenants.write()
 }
 
 func (c *NullCache) Read(obj, chunk string) bool {
 	c.stats.reads++
+	c.stats.tenants.read()
 	return false
 }
 
@@ -65,5 +67,14 @@ func (c *NullCache) Stats() *CacheStats {
 }
 
 func (c *NullCache) StatsClear() {
-	c.stats = NewCacheStats()
+	c.stats.clear()
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *NullCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *NullCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
 }
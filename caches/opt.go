@@ -0,0 +1,364 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/heap"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"math"
+)
+
+// Belady's MIN.  This is an offline policy: it must be given the
+// complete request stream the cache will see before the simulation
+// starts.  The stream is captured by running the simulation once
+// with a RecorderCache, and then replaying the same seed.
+//
+// A block is only worth keeping if its next access is a read, since
+// a write invalidates it and deleting its object frees it.  On
+// eviction, the block whose next read is furthest in the future is
+// dropped.  If the new block itself is the one used furthest in the
+// future, it is not inserted at all.
+
+const optNever = math.MaxInt64
+
+const (
+	traceRead = iota
+	traceWrite
+	traceDelete
+)
+
+// Requests seen by a cache.  The key of a deletion is its object.
+type RequestTrace struct {
+	keys []string
+	objs []string
+	ops  []int
+}
+
+func (t *RequestTrace) Len() int {
+	return len(t.keys)
+}
+
+func (t *RequestTrace) append(obj, key string, op int) {
+	t.keys = append(t.keys, key)
+	t.objs = append(t.objs, obj)
+	t.ops = append(t.ops, op)
+}
+
+// Records the request stream without caching anything
+type RecorderCache struct {
+	stats *CacheStats
+	trace *RequestTrace
+}
+
+func NewRecorderCache() *RecorderCache {
+	return &RecorderCache{
+		stats: NewCacheStats(),
+		trace: &RequestTrace{},
+	}
+}
+
+func (c *RecorderCache) Close() {
+
+}
+
+func (c *RecorderCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.trace.append(obj, obj+chunk, traceWrite)
+}
+
+func (c *RecorderCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.trace.append(obj, obj+chunk, traceRead)
+	return false
+}
+
+func (c *RecorderCache) Delete(obj string) {
+	c.stats.deletions++
+	c.trace.append(obj, obj, traceDelete)
+}
+
+func (c *RecorderCache) Trace() *RequestTrace {
+	return c.trace
+}
+
+func (c *RecorderCache) String() string {
+	return fmt.Sprintf("Recorded Requests: %d\n", c.trace.Len()) +
+		c.stats.String()
+}
+
+func (c *RecorderCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *RecorderCache) StatsClear() {
+	c.stats = NewCacheStats()
+}
+
+/* -------------------------------------------------------- */
+
+type optEntry struct {
+	key     string
+	nextuse int
+}
+
+// Max heap on next use.  Ties are broken by key so that the
+// victim does not depend on map iteration order.
+type optHeap []optEntry
+
+func (h optHeap) Len() int { return len(h) }
+func (h optHeap) Less(i, j int) bool {
+	if h[i].nextuse != h[j].nextuse {
+		return h[i].nextuse > h[j].nextuse
+	}
+	return h[i].key > h[j].key
+}
+func (h optHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *optHeap) Push(x interface{}) { *h = append(*h, x.(optEntry)) }
+func (h *optHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+type OptCache struct {
+	stats        *CacheStats
+	cachemap     map[string]int
+	objects      *objectIndex
+	nextuse      []int
+	trace        *RequestTrace
+	position     int
+	bypasses     int
+	heap         optHeap
+	cachesize    uint64
+	writethrough bool
+}
+
+func NewOptCache(cachesize uint64, writethrough bool, trace *RequestTrace) *OptCache {
+	godbc.Require(cachesize > 0)
+	godbc.Require(trace != nil)
+
+	cache := &OptCache{}
+	cache.stats = NewCacheStats()
+	cache.cachemap = make(map[string]int)
+	cache.objects = newObjectIndex()
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+	cache.trace = trace
+
+	// Walk the stream backwards to find, for every request, when
+	// the same key will next be read before being written again
+	// or having its object deleted
+	cache.nextuse = make([]int, trace.Len())
+	next := make(map[string]int)
+	objkeys := make(map[string][]string)
+	for i := trace.Len() - 1; i >= 0; i-- {
+		cache.nextuse[i] = optNever
+
+		obj := trace.objs[i]
+		if trace.ops[i] == traceDelete {
+			for _, key := range objkeys[obj] {
+				delete(next, key)
+			}
+			delete(objkeys, obj)
+			continue
+		}
+
+		key := trace.keys[i]
+		n, ok := next[key]
+		if ok && trace.ops[n] == traceRead {
+			cache.nextuse[i] = n
+		}
+		if !ok {
+			objkeys[obj] = append(objkeys[obj], key)
+		}
+		next[key] = i
+	}
+
+	godbc.Ensure(cache.cachesize > 0)
+	godbc.Ensure(len(cache.nextuse) == trace.Len())
+
+	return cache
+}
+
+func (c *OptCache) Close() {
+
+}
+
+// Advance through the recorded stream, returning the
+// next use of the key being requested
+func (c *OptCache) advance(key string, op int) int {
+	godbc.Check(c.position < c.trace.Len(),
+		"request stream is longer than the recorded stream")
+	godbc.Check(c.trace.keys[c.position] == key && c.trace.ops[c.position] == op,
+		fmt.Sprintf("request %d [%s] differs from the recorded stream [%s]",
+			c.position, key, c.trace.keys[c.position]))
+
+	nextuse := c.nextuse[c.position]
+	c.position++
+	return nextuse
+}
+
+func (c *OptCache) Invalidate(key string) {
+	if _, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.objects.remove(key)
+		delete(c.cachemap, key)
+	}
+}
+
+// Returns the resident key with the furthest next use,
+// discarding stale heap entries on the way
+func (c *OptCache) victim() optEntry {
+	for {
+		e := c.heap[0]
+		if nextuse, ok := c.cachemap[e.key]; ok && nextuse == e.nextuse {
+			return e
+		}
+		heap.Pop(&c.heap)
+	}
+}
+
+func (c *OptCache) update(key string, nextuse int) {
+	c.cachemap[key] = nextuse
+	heap.Push(&c.heap, optEntry{key: key, nextuse: nextuse})
+
+	// Drop stale entries once they dominate the heap
+	if uint64(len(c.heap)) > 4*c.cachesize {
+		c.heap = c.heap[:0]
+		for k, n := range c.cachemap {
+			c.heap = append(c.heap, optEntry{key: k, nextuse: n})
+		}
+		heap.Init(&c.heap)
+	}
+}
+
+func (c *OptCache) Insert(key string, nextuse int) {
+	if uint64(len(c.cachemap)) >= c.cachesize {
+		v := c.victim()
+		if v.nextuse <= nextuse {
+			// Caching this block would only hurt
+			c.bypasses++
+			return
+		}
+		c.stats.evictions++
+		c.stats.tenants.evict(v.key)
+		heap.Pop(&c.heap)
+		c.objects.remove(v.key)
+		delete(c.cachemap, v.key)
+	}
+
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+	c.update(key, nextuse)
+}
+
+// Insert the chunk of the object, unless it is bypassed
+func (c *OptCache) insertChunk(obj, key string, nextuse int) {
+	c.Insert(key, nextuse)
+	if _, ok := c.cachemap[key]; ok {
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *OptCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	nextuse := c.advance(key, traceWrite)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.insertChunk(obj, key, nextuse)
+	}
+}
+
+func (c *OptCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	nextuse := c.advance(key, traceRead)
+
+	if _, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+		c.update(key, nextuse)
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		c.insertChunk(obj, key, nextuse)
+		return false
+	}
+}
+
+// Free all the cached chunks of the object.  Stale heap
+// entries of the chunks are dropped by victim.
+func (c *OptCache) Delete(obj string) {
+	c.stats.deletions++
+	c.advance(obj, traceDelete)
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *OptCache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"Optimal (MIN) Read Hit Rate: %.4f\n"+
+			"Bypassed Insertions: %d\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0,
+		c.stats.ReadHitRate(),
+		c.bypasses) +
+		c.stats.String()
+}
+
+func (c *OptCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *OptCache) StatsClear() {
+	c.stats.clear()
+	c.bypasses = 0
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *OptCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *OptCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
@@ -0,0 +1,143 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func recordReads(keys ...string) *RequestTrace {
+	r := NewRecorderCache()
+	for _, key := range keys {
+		r.Read("", key)
+	}
+	return r.Trace()
+}
+
+func TestRecorderCache(t *testing.T) {
+	r := NewRecorderCache()
+	r.Read("1", "2")
+	r.Write("3", "4")
+	assert.Equal(t, 2, r.Trace().Len())
+	assert.Equal(t, []string{"12", "34"}, r.Trace().keys)
+	assert.Equal(t, []int{traceRead, traceWrite}, r.Trace().ops)
+	assert.Equal(t, 1, r.stats.reads)
+	assert.Equal(t, 1, r.stats.writes)
+}
+
+func TestNewOptCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewOptCache(0, false, &RequestTrace{})
+	})
+
+	trace := recordReads("a", "b", "a", "c", "b")
+	c := NewOptCache(2, false, trace)
+	assert.Equal(t, []int{2, 4, optNever, optNever, optNever}, c.nextuse)
+}
+
+func TestOptCacheNextUseSkipsWrites(t *testing.T) {
+	r := NewRecorderCache()
+	r.Read("", "a")
+	r.Write("", "a")
+	r.Read("", "a")
+	c := NewOptCache(2, false, r.Trace())
+
+	// A write invalidates the block, so the first read
+	// has no useful next use
+	assert.Equal(t, []int{optNever, 2, optNever}, c.nextuse)
+}
+
+func TestOptCacheDelete(t *testing.T) {
+	r := NewRecorderCache()
+	r.Read("a", "1")
+	r.Read("b", "1")
+	r.Delete("a")
+	r.Read("a", "1")
+	r.Read("b", "1")
+	r.Read("a", "1")
+	trace := r.Trace()
+	assert.Equal(t, 6, trace.Len())
+	assert.Equal(t, 1, r.stats.deletions)
+
+	// Deleting the object ends the use of its chunks
+	c := NewOptCache(1, false, trace)
+	assert.Equal(t, []int{optNever, 4, optNever, 5, optNever, optNever}, c.nextuse)
+
+	assert.False(t, c.Read("a", "1"))
+	assert.False(t, c.Read("b", "1"))
+	assert.Equal(t, 1, c.stats.evictions)
+	c.Delete("a")
+	assert.Equal(t, 0, c.stats.deletionhits)
+	assert.False(t, c.Read("a", "1"))
+	assert.True(t, c.Read("b", "1"))
+	assert.False(t, c.Read("a", "1"))
+
+	c = NewOptCache(2, false, trace)
+	c.Read("a", "1")
+	c.Read("b", "1")
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletionhits)
+	_, ok := c.cachemap["a1"]
+	assert.False(t, ok)
+
+	// Deletions are part of the recorded stream
+	assert.Panics(t, func() {
+		c.Delete("b")
+	})
+}
+
+func TestOptCacheEvictsFurthest(t *testing.T) {
+	keys := []string{"a", "b", "c", "a", "b", "a"}
+	c := NewOptCache(2, false, recordReads(keys...))
+
+	hits := 0
+	for _, key := range keys {
+		if c.Read("", key) {
+			hits++
+		}
+	}
+
+	// "c" is never used again so it is never cached,
+	// and both "a" and "b" hit afterwards
+	assert.Equal(t, 3, hits)
+	assert.Equal(t, 1, c.bypasses)
+	assert.Equal(t, 0, c.stats.evictions)
+
+	// Compare against LRU on the same stream
+	l := NewLRUCache(2, false)
+	lruhits := 0
+	for _, key := range keys {
+		if l.Read("", key) {
+			lruhits++
+		}
+	}
+	assert.True(t, hits >= lruhits)
+}
+
+func TestOptCacheStreamMismatch(t *testing.T) {
+	c := NewOptCache(2, false, recordReads("a"))
+
+	assert.Panics(t, func() {
+		c.Read("", "b")
+	})
+
+	c = NewOptCache(2, false, recordReads("a"))
+	c.Read("", "a")
+	assert.Panics(t, func() {
+		c.Read("", "a")
+	})
+}
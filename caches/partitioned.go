@@ -0,0 +1,421 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+type segmentEntry struct {
+	key    string
+	used   bool
+	tenant int
+}
+
+// CLOCK list of the blocks of one tenant
+type clockSegment struct {
+	clock *list.List
+	hand  *list.Element
+	size  uint64
+}
+
+func newClockSegment(size uint64) *clockSegment {
+	return &clockSegment{
+		clock: list.New(),
+		size:  size,
+	}
+}
+
+func (s *clockSegment) len() uint64 {
+	return uint64(s.clock.Len())
+}
+
+// New entries go right behind the hand
+func (s *clockSegment) insert(key string, tenant int) *list.Element {
+	entry := &segmentEntry{key: key, used: true, tenant: tenant}
+	if s.hand == nil {
+		return s.clock.PushBack(entry)
+	}
+	return s.clock.InsertBefore(entry, s.hand)
+}
+
+// Remove the entry, moving the clock hand past it if needed
+func (s *clockSegment) remove(e *list.Element) {
+	if e == s.hand {
+		s.hand = e.Next()
+	}
+	s.clock.Remove(e)
+}
+
+// Remove the first entry not used since the hand last
+// passed it and return its key
+func (s *clockSegment) evict() string {
+	godbc.Require(s.clock.Len() > 0)
+
+	for {
+		if s.hand == nil {
+			s.hand = s.clock.Front()
+		}
+		entry := s.hand.Value.(*segmentEntry)
+		if entry.used {
+			entry.used = false
+			s.hand = s.hand.Next()
+		} else {
+			s.remove(s.hand)
+			return entry.key
+		}
+	}
+}
+
+// Key of the entry evict would remove
+func (s *clockSegment) peek() string {
+	godbc.Require(s.clock.Len() > 0)
+
+	start := s.hand
+	if start == nil {
+		start = s.clock.Front()
+	}
+	e := start
+	for {
+		if !e.Value.(*segmentEntry).used {
+			return e.Value.(*segmentEntry).key
+		}
+		if e = e.Next(); e == nil {
+			e = s.clock.Front()
+		}
+		if e == start {
+			return start.Value.(*segmentEntry).key
+		}
+	}
+}
+
+// Cache divided between its tenants.  Each tenant has its own
+// CLOCK segment and the mode sets which segment loses a block
+// when the cache is full:
+//
+//	static:   Each tenant only uses its share of the cache.
+//	reserved: Each tenant keeps a reserved minimum of its share
+//	          of the reserved percentage of the cache.  The rest
+//	          is shared, and evictions come from the tenant with
+//	          the most blocks above its minimum.
+//	weighted: Tenants may use the whole cache, but evictions come
+//	          from the tenant most above its share.
+//
+// Shares are proportional to the weights of the tenants, or
+// equal when no weights are given.  Reads hit blocks of any
+// tenant, and blocks inserted go to the segment of the tenant
+// of the request.
+type PartitionedCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]*list.Element
+	objects      *objectIndex
+	segments     []*clockSegment
+	cachesize    uint64
+	writethrough bool
+	mode         string
+	weights      []int
+	reserved     int
+	tenant       int
+}
+
+func NewPartitionedCache(cachesize uint64,
+	writethrough bool,
+	mode string,
+	weights []int,
+	reserved int) *PartitionedCache {
+
+	godbc.Require(cachesize > 0)
+	godbc.Require(mode == "static" || mode == "reserved" || mode == "weighted",
+		"Unknown partition mode", mode)
+	godbc.Require(0 <= reserved && reserved <= 100)
+
+	cache := &PartitionedCache{}
+	cache.stats = NewCacheStats()
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+	cache.mode = mode
+	cache.weights = weights
+	cache.reserved = reserved
+	cache.partition(1)
+
+	godbc.Ensure(len(cache.segments) == 1)
+
+	return cache
+}
+
+// Divide the cache between n tenants.  The cache is emptied.
+func (c *PartitionedCache) partition(n int) {
+	godbc.Require(uint64(n) <= c.cachesize, "More tenants than cache blocks")
+
+	weights := c.weights
+	if len(weights) != n {
+		weights = make([]int, n)
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	total := 0
+	for _, w := range weights {
+		godbc.Require(w > 0)
+		total += w
+	}
+
+	// Static partitions use the whole cache
+	size := c.cachesize
+	if c.mode == "reserved" {
+		size = c.cachesize * uint64(c.reserved) / 100
+	}
+
+	c.cachemap = make(map[string]*list.Element)
+	c.objects = newObjectIndex()
+	c.segments = make([]*clockSegment, n)
+	var assigned uint64
+	for i := range c.segments {
+		c.segments[i] = newClockSegment(size * uint64(weights[i]) / uint64(total))
+		assigned += c.segments[i].size
+	}
+
+	// Give the remainder to the first tenants
+	for i := 0; assigned < size; i = (i + 1) % n {
+		c.segments[i].size++
+		assigned++
+	}
+
+	godbc.Ensure(assigned == size)
+}
+
+// Segment losing a block to make room for a block of the
+// current tenant, or nil if there is room
+func (c *PartitionedCache) victim() *clockSegment {
+	own := c.segments[c.tenant]
+	if c.mode == "static" {
+		if own.len() >= own.size {
+			return own
+		}
+		return nil
+	}
+
+	if uint64(len(c.cachemap)) < c.cachesize {
+		return nil
+	}
+
+	// Prefer the segment of the current tenant on ties
+	var best *clockSegment
+	for _, s := range append([]*clockSegment{own}, c.segments...) {
+		if s.len() == 0 {
+			continue
+		}
+
+		switch c.mode {
+		case "reserved":
+			if s.len() <= s.size {
+				continue
+			}
+			if best == nil || s.len()-s.size > best.len()-best.size {
+				best = s
+			}
+		case "weighted":
+			// Compare len / size without dividing
+			if best == nil || s.len()*best.size > best.len()*s.size {
+				best = s
+			}
+		}
+	}
+
+	// Every tenant is within its reserved minimum
+	if best == nil {
+		for _, s := range append([]*clockSegment{own}, c.segments...) {
+			if best == nil || s.len() > best.len() {
+				best = s
+			}
+		}
+	}
+
+	return best
+}
+
+func (c *PartitionedCache) Close() {
+
+}
+
+func (c *PartitionedCache) Invalidate(key string) {
+	if e, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.remove(key, e)
+	}
+}
+
+// Remove the block from the segment of its tenant
+func (c *PartitionedCache) remove(key string, e *list.Element) {
+	c.segments[e.Value.(*segmentEntry).tenant].remove(e)
+	c.objects.remove(key)
+	delete(c.cachemap, key)
+}
+
+func (c *PartitionedCache) Insert(key string) {
+	s := c.victim()
+	if s != nil && s.len() == 0 {
+		// The tenant has no room in the cache
+		return
+	}
+
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if s != nil {
+		c.stats.evictions++
+		evictkey := s.evict()
+		c.stats.tenants.evict(evictkey)
+		c.objects.remove(evictkey)
+		delete(c.cachemap, evictkey)
+	}
+
+	c.cachemap[key] = c.segments[c.tenant].insert(key, c.tenant)
+}
+
+func (c *PartitionedCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.insertChunk(obj, key)
+	}
+}
+
+// Insert the chunk of the object, if the tenant has room for it
+func (c *PartitionedCache) insertChunk(obj, key string) {
+	c.Insert(key)
+	if _, ok := c.cachemap[key]; ok {
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *PartitionedCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		// Clock Algorithm: Set that we looked
+		// at it
+		e.Value.(*segmentEntry).used = true
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.insertChunk(obj, key)
+		}
+		return false
+	}
+}
+
+// Free all the cached chunks of the object in the
+// segments of the tenants which inserted them
+func (c *PartitionedCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.remove(key, c.cachemap[key])
+	}
+}
+
+func (c *PartitionedCache) String() string {
+	s := fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0)
+	for i, segment := range c.segments {
+		s += fmt.Sprintf("Partition %d: %d blocks, %s %d\n",
+			i, segment.len(), c.sizeName(), segment.size)
+	}
+
+	return s + c.stats.String()
+}
+
+// What the size of a segment means in the mode
+func (c *PartitionedCache) sizeName() string {
+	switch c.mode {
+	case "static":
+		return "quota"
+	case "reserved":
+		return "reserved"
+	}
+	return "share"
+}
+
+func (c *PartitionedCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *PartitionedCache) StatsClear() {
+	c.stats.clear()
+}
+
+// Divide the cache between the tenants and track their stats.
+// The cache is emptied if the number of tenants changes.
+func (c *PartitionedCache) SetTenants(n int) {
+	if n != len(c.segments) {
+		c.partition(n)
+		c.tenant = 0
+	}
+	c.stats.setTenants(n)
+}
+
+func (c *PartitionedCache) SetTenant(tenant int) {
+	godbc.Require(0 <= tenant && tenant < len(c.segments), "Unknown tenant", tenant)
+	c.tenant = tenant
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *PartitionedCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *PartitionedCache) victimKey() string {
+	s := c.victim()
+	if s == nil || s.len() == 0 {
+		return ""
+	}
+	return s.peek()
+}
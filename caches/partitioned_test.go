@@ -0,0 +1,170 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+// Read count blocks as the tenant
+func partitionedReads(c *PartitionedCache, tenant, count int) {
+	c.SetTenant(tenant)
+	for i := 0; i < count; i++ {
+		c.Read(strconv.Itoa(tenant)+"/", strconv.Itoa(i))
+	}
+}
+
+func TestNewPartitionedCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewPartitionedCache(0, true, "static", nil, 0)
+	})
+	assert.Panics(t, func() {
+		NewPartitionedCache(10, true, "nosuchmode", nil, 0)
+	})
+
+	c := NewPartitionedCache(10, true, "static", nil, 0)
+	assert.Equal(t, 1, len(c.segments))
+	assert.Equal(t, uint64(10), c.segments[0].size)
+
+	// Remainder goes to the first tenants
+	c.SetTenants(3)
+	assert.Equal(t, uint64(4), c.segments[0].size)
+	assert.Equal(t, uint64(3), c.segments[1].size)
+	assert.Equal(t, uint64(3), c.segments[2].size)
+
+	c = NewPartitionedCache(100, true, "reserved", []int{3, 1}, 40)
+	c.SetTenants(2)
+	assert.Equal(t, uint64(30), c.segments[0].size)
+	assert.Equal(t, uint64(10), c.segments[1].size)
+	assert.Panics(t, func() {
+		c.SetTenant(2)
+	})
+}
+
+func TestPartitionedCacheStatic(t *testing.T) {
+	c := NewPartitionedCache(10, true, "static", []int{3, 2}, 0)
+	c.SetTenants(2)
+
+	// Tenant 1 cannot use the free space of tenant 0
+	partitionedReads(c, 1, 10)
+	assert.Equal(t, uint64(4), c.segments[1].len())
+	assert.Equal(t, 6, c.stats.evictions)
+
+	partitionedReads(c, 0, 10)
+	assert.Equal(t, uint64(6), c.segments[0].len())
+	assert.Equal(t, uint64(4), c.segments[1].len())
+
+	tenants := c.Stats().Tenants()
+	assert.Equal(t, 6, tenants[0].Blocks())
+	assert.Equal(t, 4, tenants[1].Blocks())
+	assert.Equal(t, 6, tenants[1].Evictions())
+	assert.Equal(t, 6, tenants[1].EvictionsCaused())
+
+	// Hits on blocks of other tenants
+	c.SetTenant(1)
+	assert.True(t, c.Read("0/", "9"))
+}
+
+func TestPartitionedCacheNoRoom(t *testing.T) {
+	c := NewPartitionedCache(3, true, "static", []int{10, 10, 1}, 0)
+	c.SetTenants(3)
+	assert.Equal(t, uint64(0), c.segments[2].size)
+
+	partitionedReads(c, 2, 2)
+	assert.Equal(t, uint64(0), c.segments[2].len())
+	assert.Equal(t, 0, c.stats.insertions)
+	assert.Equal(t, 2, c.stats.reads)
+}
+
+func TestPartitionedCacheReserved(t *testing.T) {
+	c := NewPartitionedCache(10, true, "reserved", []int{3, 1}, 80)
+	c.SetTenants(2)
+	assert.Equal(t, uint64(6), c.segments[0].size)
+	assert.Equal(t, uint64(2), c.segments[1].size)
+
+	// Tenant 0 may use the whole cache
+	partitionedReads(c, 0, 10)
+	assert.Equal(t, uint64(10), c.segments[0].len())
+
+	// but keeps its minimum, and the rest is divided
+	partitionedReads(c, 1, 100)
+	assert.Equal(t, uint64(7), c.segments[0].len())
+	assert.Equal(t, uint64(3), c.segments[1].len())
+
+	// Tenant 1 recycles its own blocks when it is
+	// below its minimum and the cache is full
+	c = NewPartitionedCache(10, true, "reserved", nil, 100)
+	c.SetTenants(2)
+	partitionedReads(c, 0, 10)
+	partitionedReads(c, 1, 10)
+	assert.Equal(t, uint64(5), c.segments[0].len())
+	assert.Equal(t, uint64(5), c.segments[1].len())
+}
+
+func TestPartitionedCacheWeighted(t *testing.T) {
+	c := NewPartitionedCache(12, true, "weighted", []int{2, 1}, 0)
+	c.SetTenants(2)
+
+	partitionedReads(c, 1, 12)
+	assert.Equal(t, uint64(12), c.segments[1].len())
+
+	// Evictions come from the tenant most above its share
+	partitionedReads(c, 0, 20)
+	assert.Equal(t, uint64(8), c.segments[0].len())
+	assert.Equal(t, uint64(4), c.segments[1].len())
+	assert.Equal(t, 12, len(c.cachemap))
+
+	// Writes move blocks to the segment of the writer
+	c.SetTenant(1)
+	c.Write("0/", "19")
+	assert.Equal(t, uint64(7), c.segments[0].len())
+	assert.Equal(t, uint64(5), c.segments[1].len())
+}
+
+func TestPartitionedCacheDelete(t *testing.T) {
+	c := NewPartitionedCache(10, true, "static", nil, 0)
+	c.SetTenants(2)
+	partitionedReads(c, 0, 5)
+	partitionedReads(c, 1, 5)
+
+	// Tenant 1 deletes a file of tenant 0
+	c.Delete("0/")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.segments[0].len())
+	assert.Equal(t, uint64(5), c.segments[1].len())
+	assert.Equal(t, 5, len(c.cachemap))
+	assert.Equal(t, 0, c.Stats().Tenants()[0].Blocks())
+
+	// The quota of tenant 0 is free again
+	partitionedReads(c, 0, 5)
+	assert.Equal(t, uint64(5), c.segments[0].len())
+	assert.Equal(t, 0, c.stats.evictions)
+
+	c.Delete("2/")
+	assert.Equal(t, 2, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+
+	// Evicted chunks are forgotten
+	partitionedReads(c, 1, 10)
+	c.Delete("1/")
+	assert.Equal(t, 2, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.segments[1].len())
+	assert.Equal(t, 5, len(c.objects.objs))
+	assert.Equal(t, 5, len(c.cachemap))
+}
@@ -0,0 +1,399 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// S3-FIFO cache as described by Yang, Zhang, Qiu, Yue and Rashmi
+// in "FIFO Queues are All You Need for Cache Eviction", SOSP 2023.
+//
+// New keys go to the small FIFO queue S.  Keys leaving S which were
+// read more than once move to the main FIFO queue M, the others are
+// evicted and remembered in the ghost FIFO queue G.  A miss on a key
+// in G inserts it straight into M.  Keys leaving M which were read
+// since they were inserted go back to the head of M with their
+// frequency decreased.  Frequencies are capped at 3.
+
+const (
+	s3fifoSmall = iota
+	s3fifoMain
+
+	s3fifoMaxFreq = 3
+)
+
+// Ring of the keys evicted from S.  The position of each key in
+// the ring is kept in a map, and keys overwritten by the ring are
+// forgotten.
+type ghostRing struct {
+	keys      []string
+	positions map[string]uint64
+	index     uint64
+}
+
+func newGhostRing(size uint64) *ghostRing {
+	return &ghostRing{
+		keys:      make([]string, size),
+		positions: make(map[string]uint64),
+	}
+}
+
+func (g *ghostRing) len() int {
+	return len(g.positions)
+}
+
+func (g *ghostRing) add(key string) {
+	pos := g.index % uint64(len(g.keys))
+	if old := g.keys[pos]; old != "" {
+		if p, ok := g.positions[old]; ok && p == pos {
+			delete(g.positions, old)
+		}
+	}
+	g.keys[pos] = key
+	g.positions[key] = pos
+	g.index++
+}
+
+// Forget the key and return if it was in the ring
+func (g *ghostRing) remove(key string) bool {
+	if _, ok := g.positions[key]; ok {
+		delete(g.positions, key)
+		return true
+	}
+	return false
+}
+
+type s3fifoStats struct {
+	promotions   int
+	ghosthits    int
+	reinsertions int
+}
+
+type S3FIFOCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	s3stats      *s3fifoStats
+	cachemap     map[string]int
+	objects      *objectIndex
+	slots        *slotQueues
+	mainfreqs    [s3fifoMaxFreq + 1]int
+	victim       int
+	ghost        *ghostRing
+	smallsize    uint64
+	mainsize     uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+// small is the % of the cache used by the small queue.  The
+// ghost queue remembers as many keys as the main queue holds.
+func NewS3FIFOCache(cachesize uint64,
+	writethrough bool,
+	small int) *S3FIFOCache {
+
+	godbc.Require(cachesize > 0)
+	godbc.Require(0 < small && small < 100)
+
+	cache := &S3FIFOCache{}
+	cache.stats = NewCacheStats()
+	cache.s3stats = &s3fifoStats{}
+	cache.cachemap = make(map[string]int)
+	cache.objects = newObjectIndex()
+	cache.slots = newSlotQueues(cachesize, 2)
+	cache.victim = noSlot
+	cache.cachesize = cachesize
+	cache.smallsize = cachesize * uint64(small) / 100
+	cache.mainsize = cachesize - cache.smallsize
+	cache.ghost = newGhostRing(cache.mainsize)
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+	godbc.Ensure(cache.mainsize > 0)
+
+	return cache
+}
+
+func (c *S3FIFOCache) Close() {
+
+}
+
+func (c *S3FIFOCache) drop(i int) {
+	c.stats.evictions++
+	c.stats.tenants.evict(c.slots.slots[i].key)
+	c.remove(i)
+}
+
+// Add n to the number of keys of M with the frequency
+// of slot i, if it is in M
+func (c *S3FIFOCache) countMain(i, n int) {
+	if c.slots.slots[i].queue == s3fifoMain {
+		c.mainfreqs[c.slots.slots[i].freq] += n
+	}
+}
+
+func (c *S3FIFOCache) remove(i int) {
+	c.victim = noSlot
+	c.countMain(i, -1)
+	c.objects.remove(c.slots.slots[i].key)
+	delete(c.cachemap, c.slots.slots[i].key)
+	c.slots.remove(i)
+}
+
+// Evict the oldest key of S, or move it to M if it was read
+// more than once
+func (c *S3FIFOCache) evictSmall() {
+	for c.slots.len(s3fifoSmall) > 0 {
+		i := c.slots.oldest(s3fifoSmall)
+		if c.slots.slots[i].freq > 1 {
+			c.s3stats.promotions++
+			c.slots.slots[i].freq = 0
+			c.slots.move(i, s3fifoMain)
+			c.countMain(i, 1)
+			if c.slots.len(s3fifoMain) > c.mainsize {
+				c.evictMain()
+				return
+			}
+		} else {
+			c.ghost.add(c.slots.slots[i].key)
+			c.drop(i)
+			return
+		}
+	}
+}
+
+// Evict the oldest key of M which was not read since it
+// was last inserted or moved back to the head of M
+func (c *S3FIFOCache) evictMain() {
+	for {
+		i := c.slots.oldest(s3fifoMain)
+		if c.slots.slots[i].freq > 0 {
+			c.s3stats.reinsertions++
+			c.countMain(i, -1)
+			c.slots.slots[i].freq--
+			c.countMain(i, 1)
+			c.slots.move(i, s3fifoMain)
+		} else {
+			c.drop(i)
+			return
+		}
+	}
+}
+
+// Make room from S while it is over its size or M is empty.
+// Moving keys from S to M may not evict anything, so this is
+// repeated until there is room.
+func (c *S3FIFOCache) Evict() {
+	small := c.slots.len(s3fifoSmall)
+	if small > 0 && (small >= c.smallsize || c.slots.len(s3fifoMain) == 0) {
+		c.evictSmall()
+	} else {
+		c.evictMain()
+	}
+}
+
+func (c *S3FIFOCache) Invalidate(key string) {
+	if i, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.remove(i)
+	}
+}
+
+// Insert a key which is not resident.  A key remembered
+// by G goes straight to M.
+func (c *S3FIFOCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	c.victim = noSlot
+	for uint64(len(c.cachemap)) >= c.cachesize {
+		c.Evict()
+	}
+
+	queue := s3fifoSmall
+	if c.ghost.remove(key) {
+		c.s3stats.ghosthits++
+		queue = s3fifoMain
+	}
+	i := c.slots.push(queue, key)
+	c.countMain(i, 1)
+	c.cachemap[key] = i
+}
+
+func (c *S3FIFOCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *S3FIFOCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if i, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		if c.slots.slots[i].freq < s3fifoMaxFreq {
+			c.countMain(i, -1)
+			c.slots.slots[i].freq++
+			c.countMain(i, 1)
+		}
+		if i == c.victim {
+			c.victim = noSlot
+		}
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
+		return false
+	}
+}
+
+// Free all the cached chunks of the object.  They are not
+// remembered by G, since the data no longer exists.
+func (c *S3FIFOCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.remove(c.cachemap[key])
+	}
+}
+
+func (c *S3FIFOCache) String() string {
+	s := c.s3stats
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"Small: %d Main: %d Ghost: %d\n"+
+			"Small Size: %d Main Size: %d\n"+
+			"Promotions from Small to Main: %d\n"+
+			"Ghost Hits: %d\n"+
+			"Main Reinsertions: %d\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0,
+		c.slots.len(s3fifoSmall), c.slots.len(s3fifoMain), c.ghost.len(),
+		c.smallsize, c.mainsize,
+		s.promotions,
+		s.ghosthits,
+		s.reinsertions) +
+		c.stats.String()
+}
+
+func (c *S3FIFOCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *S3FIFOCache) StatsClear() {
+	c.stats.clear()
+	c.s3stats = &s3fifoStats{}
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *S3FIFOCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *S3FIFOCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *S3FIFOCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *S3FIFOCache) victimKey() string {
+	if uint64(len(c.cachemap)) < c.cachesize {
+		return ""
+	}
+
+	// Only a hit on the victim itself, an insert or a removal
+	// changes it, so it is kept until then and the misses
+	// rejected meanwhile do not look for it again
+	if c.victim == noSlot {
+		c.victim = c.findVictim()
+	}
+	return c.slots.slots[c.victim].key
+}
+
+// Evict may move keys from S to M before evicting, so this follows
+// it without changing the queues: keys of S read more than once move
+// to M until M is over its size, and M then evicts the key whose
+// frequency reaches 0 first, which is the oldest key with the lowest
+// frequency.  Keys moved from S have a frequency of 0 and are newer
+// than M.  Both walks stop where Evict would stop, so they cost no
+// more than the eviction.
+func (c *S3FIFOCache) findVictim() int {
+	moved := noSlot
+	small, main := c.slots.len(s3fifoSmall), c.slots.len(s3fifoMain)
+	if small > 0 && (small >= c.smallsize || main == 0) {
+		for i := c.slots.oldest(s3fifoSmall); i != noSlot; i = c.slots.newer(i) {
+			if c.slots.slots[i].freq <= 1 {
+				return i
+			}
+			if moved == noSlot {
+				moved = i
+			}
+			if main++; main > c.mainsize {
+				break
+			}
+		}
+	}
+
+	if moved != noSlot && c.mainfreqs[0] == 0 {
+		return moved
+	}
+
+	lowest := uint8(0)
+	for c.mainfreqs[lowest] == 0 {
+		lowest++
+	}
+	i := c.slots.oldest(s3fifoMain)
+	for c.slots.slots[i].freq != lowest {
+		i = c.slots.newer(i)
+	}
+	return i
+}
@@ -0,0 +1,236 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestNewS3FIFOCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewS3FIFOCache(0, false, 10)
+	})
+	assert.Panics(t, func() {
+		NewS3FIFOCache(100, false, 100)
+	})
+
+	c := NewS3FIFOCache(uint64(100), true, 10)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, uint64(10), c.smallsize)
+	assert.Equal(t, uint64(90), c.mainsize)
+	assert.Equal(t, 90, len(c.ghost.keys))
+	assert.True(t, c.writethrough)
+}
+
+func TestS3FIFOCacheQueues(t *testing.T) {
+	c := NewS3FIFOCache(10, false, 20)
+
+	c.Read("", "a")
+	c.Read("", "a")
+	c.Read("", "a")
+	for i := 1; i < 10; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	assert.Equal(t, uint64(10), c.slots.len(s3fifoSmall))
+
+	// Leaving S, a was read more than once and moves to M,
+	// but 1 is evicted into G
+	c.Read("", "x")
+	assert.Equal(t, 1, c.s3stats.promotions)
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, s3fifoMain, c.slots.slots[c.cachemap["a"]].queue)
+	assert.Equal(t, 1, c.ghost.len())
+	_, ok := c.cachemap["1"]
+	assert.False(t, ok)
+
+	// A miss on G goes straight to M
+	assert.False(t, c.Read("", "1"))
+	assert.Equal(t, 1, c.s3stats.ghosthits)
+	assert.Equal(t, s3fifoMain, c.slots.slots[c.cachemap["1"]].queue)
+	assert.Equal(t, 1, c.ghost.len())
+
+	// Keys read in M go back to its head
+	assert.True(t, c.Read("", "a"))
+	c.evictMain()
+	assert.Equal(t, 1, c.s3stats.reinsertions)
+	_, ok = c.cachemap["1"]
+	assert.False(t, ok)
+	assert.Equal(t, uint8(0), c.slots.slots[c.cachemap["a"]].freq)
+
+	assert.Contains(t, c.String(), "Promotions from Small to Main: 1")
+	c.StatsClear()
+	assert.Equal(t, 0, c.s3stats.promotions)
+}
+
+func TestS3FIFOCacheScanResistance(t *testing.T) {
+	c := NewS3FIFOCache(10, false, 10)
+
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 5; j++ {
+			c.Read("", strconv.Itoa(j))
+		}
+	}
+
+	// A long scan only passes through S
+	for i := 100; i < 200; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	for j := 0; j < 5; j++ {
+		assert.True(t, c.Read("", strconv.Itoa(j)))
+	}
+	assert.Equal(t, 10, len(c.cachemap))
+	assert.True(t, c.ghost.len() <= 9)
+
+	// Without room for S every key goes through M
+	c = NewS3FIFOCache(5, false, 10)
+	assert.Equal(t, uint64(0), c.smallsize)
+	for i := 0; i < 40; i++ {
+		c.Read("", strconv.Itoa(i%20))
+	}
+	assert.Equal(t, 5, len(c.cachemap))
+}
+
+func TestGhostRing(t *testing.T) {
+	g := newGhostRing(2)
+	g.add("a")
+	g.add("b")
+	assert.Equal(t, 2, g.len())
+
+	// The ring forgets the oldest key
+	g.add("c")
+	assert.Equal(t, 2, g.len())
+	assert.False(t, g.remove("a"))
+
+	// A key added again is not forgotten by its old position
+	g.add("b")
+	g.add("d")
+	assert.True(t, g.remove("b"))
+	assert.True(t, g.remove("d"))
+	assert.Equal(t, 0, g.len())
+}
+
+func TestS3FIFOCacheInvalidate(t *testing.T) {
+	c := NewS3FIFOCache(2, true, 50)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.slots.len(s3fifoSmall))
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, 1, len(c.cachemap))
+
+	c = NewS3FIFOCache(2, false, 50)
+	c.Read("", "a")
+	c.Write("", "a")
+	assert.Equal(t, uint64(0), c.slots.len(s3fifoSmall))
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestS3FIFOCacheDelete(t *testing.T) {
+	c := NewS3FIFOCache(4, false, 50)
+
+	c.Read("a", "1")
+	c.Read("a", "1")
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Read("b", "1")
+	c.Read("b", "2")
+	c.Read("c", "1")
+	assert.Equal(t, uint64(1), c.slots.len(s3fifoMain))
+	assert.Equal(t, 1, c.ghost.len())
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.slots.len(s3fifoMain))
+	assert.Equal(t, uint64(3), c.slots.len(s3fifoSmall))
+
+	// Keys remembered by G are not cached, so they are kept
+	assert.False(t, c.Read("a", "2"))
+	assert.Equal(t, 1, c.s3stats.ghosthits)
+	assert.Equal(t, uint64(1), c.slots.len(s3fifoMain))
+
+	c.Delete("a")
+	c.Delete("b")
+	c.Delete("c")
+	assert.Equal(t, 4, c.stats.deletionhits)
+	assert.Equal(t, 0, len(c.cachemap))
+	assert.Equal(t, 0, len(c.objects.objs))
+}
+
+func TestS3FIFOCacheVictimKey(t *testing.T) {
+	c := NewS3FIFOCache(10, false, 30)
+	r := rand.New(rand.NewSource(1))
+
+	// The victim is the key the insert removes, even when
+	// keys move from S to M or are reinserted into M first
+	for i := 0; i < 5000; i++ {
+		key := strconv.Itoa(r.Intn(30))
+		if _, ok := c.cachemap[key]; ok {
+			c.Read("", key)
+			continue
+		}
+
+		victim := c.victimKey()
+		c.Read("", key)
+		if victim == "" {
+			assert.Equal(t, 0, c.stats.evictions)
+			continue
+		}
+		_, ok := c.cachemap[victim]
+		assert.False(t, ok, victim)
+		assert.Equal(t, 10, len(c.cachemap))
+	}
+	assert.True(t, c.s3stats.promotions > 0)
+	assert.True(t, c.s3stats.reinsertions > 0)
+}
+
+func TestS3FIFOCacheVictimKept(t *testing.T) {
+	c := NewS3FIFOCache(10, true, 30)
+	r := rand.New(rand.NewSource(1))
+
+	// The victim kept between misses is the one found from the
+	// queues, and the frequencies of M are counted as they change
+	for i := 0; i < 5000; i++ {
+		obj := strconv.Itoa(r.Intn(3))
+		chunk := strconv.Itoa(int(r.ExpFloat64() * 8))
+		switch r.Intn(10) {
+		case 0:
+			c.Write(obj, chunk)
+		case 1:
+			c.Delete(obj)
+		case 2, 3:
+			// Read miss rejected by the admission policy
+			c.victimKey()
+		default:
+			c.Read(obj, chunk)
+		}
+
+		var freqs [s3fifoMaxFreq + 1]int
+		for i := c.slots.oldest(s3fifoMain); i != noSlot; i = c.slots.newer(i) {
+			freqs[c.slots.slots[i].freq]++
+		}
+		assert.Equal(t, freqs, c.mainfreqs)
+		if victim := c.victimKey(); victim != "" {
+			assert.Equal(t, c.slots.slots[c.findVictim()].key, victim)
+		}
+	}
+	assert.True(t, c.s3stats.reinsertions > 0)
+}
@@ -0,0 +1,256 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// SIEVE cache as described by Zhang, Yang, Yue, Vigfusson and
+// Rashmi in "SIEVE is Simpler than LRU: an Efficient Turn-Key
+// Eviction Algorithm for Web Caches", NSDI 2024.
+//
+// Keys are kept in a FIFO queue with a visited bit set by hits.
+// The hand moves from the oldest key towards the newest, clearing
+// visited bits, and evicts the first key not visited.  Unlike the
+// CLOCK of IoCacheBlocks, new keys always go to the head of the
+// queue, and the hand stays where the last eviction left it.
+
+const sieveQueue = 0
+
+type SIEVECache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]int
+	objects      *objectIndex
+	slots        *slotQueues
+	hand         int
+	victim       int
+	cleared      int
+	cachesize    uint64
+	writethrough bool
+}
+
+func NewSIEVECache(cachesize uint64, writethrough bool) *SIEVECache {
+	godbc.Require(cachesize > 0)
+
+	cache := &SIEVECache{}
+	cache.stats = NewCacheStats()
+	cache.cachemap = make(map[string]int)
+	cache.objects = newObjectIndex()
+	cache.slots = newSlotQueues(cachesize, 1)
+	cache.hand = noSlot
+	cache.victim = noSlot
+	cache.cachesize = cachesize
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+
+	return cache
+}
+
+func (c *SIEVECache) Close() {
+
+}
+
+// Slot after i in the direction of the hand, wrapping
+// from the newest key back to the oldest
+func (c *SIEVECache) advance(i int) int {
+	if i = c.slots.newer(i); i == noSlot {
+		i = c.slots.oldest(sieveQueue)
+	}
+	return i
+}
+
+// Remove a slot, moving the hand past it if needed
+func (c *SIEVECache) remove(i int) {
+	c.victim = noSlot
+	if i == c.hand {
+		c.hand = c.slots.newer(i)
+	}
+	c.objects.remove(c.slots.slots[i].key)
+	delete(c.cachemap, c.slots.slots[i].key)
+	c.slots.remove(i)
+}
+
+func (c *SIEVECache) Evict() {
+	c.stats.evictions++
+
+	i := c.hand
+	if i == noSlot {
+		i = c.slots.oldest(sieveQueue)
+	}
+	for c.slots.slots[i].freq > 0 {
+		c.slots.slots[i].freq = 0
+		c.cleared++
+		i = c.advance(i)
+	}
+
+	// The hand moves on to the next newer key
+	c.stats.tenants.evict(c.slots.slots[i].key)
+	c.hand = i
+	c.remove(i)
+}
+
+func (c *SIEVECache) Invalidate(key string) {
+	if i, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.remove(i)
+	}
+}
+
+func (c *SIEVECache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if uint64(len(c.cachemap)) >= c.cachesize {
+		c.Evict()
+	}
+
+	c.victim = noSlot
+	c.cachemap[key] = c.slots.push(sieveQueue, key)
+}
+
+func (c *SIEVECache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *SIEVECache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if i, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		// Visited
+		c.slots.slots[i].freq = 1
+		if i == c.victim {
+			c.victim = noSlot
+		}
+		return true
+	} else {
+		// Read miss
+		// We would do IO here
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+			c.objects.add(obj, key)
+		}
+		return false
+	}
+}
+
+// Free all the cached chunks of the object
+func (c *SIEVECache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		c.stats.tenants.invalidate(key)
+		c.remove(c.cachemap[key])
+	}
+}
+
+func (c *SIEVECache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"Visited Bits Cleared: %d\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0,
+		c.cleared) +
+		c.stats.String()
+}
+
+func (c *SIEVECache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *SIEVECache) StatsClear() {
+	c.stats.clear()
+	c.cleared = 0
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *SIEVECache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *SIEVECache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *SIEVECache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *SIEVECache) victimKey() string {
+	if uint64(len(c.cachemap)) < c.cachesize {
+		return ""
+	}
+
+	// The keys between the hand and the victim were all visited,
+	// so only a hit on the victim itself, an insert or a removal
+	// changes it.  The victim is kept until then, and the misses
+	// rejected meanwhile do not scan the keys again.
+	if c.victim == noSlot {
+		c.victim = c.findVictim()
+	}
+	return c.slots.slots[c.victim].key
+}
+
+// The first slot from the hand not visited.  If all of them
+// were visited, the hand clears them all and comes back.
+func (c *SIEVECache) findVictim() int {
+	start := c.hand
+	if start == noSlot {
+		start = c.slots.oldest(sieveQueue)
+	}
+	for i := start; ; {
+		if c.slots.slots[i].freq == 0 {
+			return i
+		}
+		if i = c.advance(i); i == start {
+			return start
+		}
+	}
+}
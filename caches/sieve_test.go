@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestNewSIEVECache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewSIEVECache(0, false)
+	})
+
+	c := NewSIEVECache(uint64(100), true)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, noSlot, c.hand)
+	assert.True(t, c.writethrough)
+}
+
+func TestSIEVECacheEvict(t *testing.T) {
+	c := NewSIEVECache(3, false)
+
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.True(t, c.Read("", "a"))
+
+	// The hand starts at the oldest key, clears the visited
+	// a and evicts b
+	assert.False(t, c.Read("", "d"))
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, 1, c.cleared)
+	_, ok := c.cachemap["b"]
+	assert.False(t, ok)
+	assert.Equal(t, "c", c.slots.slots[c.hand].key)
+
+	// The hand stays among the newer keys, so a is kept
+	// even though it is the oldest key
+	c.Read("", "e")
+	c.Read("", "f")
+	_, ok = c.cachemap["c"]
+	assert.False(t, ok)
+	_, ok = c.cachemap["d"]
+	assert.False(t, ok)
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, 3, len(c.cachemap))
+	assert.Contains(t, c.String(), "Visited Bits Cleared: 1")
+
+	c.StatsClear()
+	assert.Equal(t, 0, c.cleared)
+}
+
+func TestSIEVECacheInvalidate(t *testing.T) {
+	c := NewSIEVECache(2, true)
+
+	c.Write("", "a")
+	assert.Equal(t, 1, len(c.cachemap))
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, 1, len(c.cachemap))
+
+	// Invalidating the key at the hand moves the hand
+	c = NewSIEVECache(2, false)
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.Equal(t, "b", c.slots.slots[c.hand].key)
+	c.Write("", "b")
+	assert.Equal(t, "c", c.slots.slots[c.hand].key)
+	_, ok := c.cachemap["b"]
+	assert.False(t, ok)
+}
+
+func TestSIEVECacheDelete(t *testing.T) {
+	c := NewSIEVECache(3, false)
+
+	c.Read("a", "1")
+	c.Read("b", "1")
+	c.Read("c", "1")
+	c.Read("a", "1")
+	c.Read("d", "1")
+	assert.Equal(t, "c1", c.slots.slots[c.hand].key)
+
+	// Deleting the key at the hand moves the hand
+	c.Delete("c")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, "d1", c.slots.slots[c.hand].key)
+	assert.Equal(t, 2, len(c.cachemap))
+
+	c.Delete("b")
+	assert.Equal(t, 1, c.stats.deletionhits)
+
+	c.Delete("a")
+	c.Delete("d")
+	assert.Equal(t, 0, len(c.cachemap))
+	assert.Equal(t, uint64(0), c.slots.len(sieveQueue))
+	assert.Equal(t, 0, len(c.objects.objs))
+	assert.False(t, c.Read("a", "1"))
+}
+
+func TestSIEVECacheVictimKey(t *testing.T) {
+	c := NewSIEVECache(10, true)
+	r := rand.New(rand.NewSource(1))
+
+	// The victim kept between misses is the one a scan
+	// from the hand finds, whatever happens meanwhile
+	for i := 0; i < 5000; i++ {
+		obj := strconv.Itoa(r.Intn(3))
+		chunk := strconv.Itoa(r.Intn(10))
+		switch r.Intn(10) {
+		case 0:
+			c.Write(obj, chunk)
+		case 1:
+			c.Delete(obj)
+		case 2, 3:
+			// Read miss rejected by the admission policy
+			c.victimKey()
+		default:
+			c.Read(obj, chunk)
+		}
+
+		if victim := c.victimKey(); victim != "" {
+			assert.Equal(t, c.slots.slots[c.findVictim()].key, victim)
+		}
+	}
+	assert.True(t, c.stats.evictions > 0)
+}
@@ -16,17 +16,26 @@
 package caches
 
 import (
+	"container/list"
 	"fmt"
 	"github.com/lpabon/godbc"
 	"strconv"
 )
 
+type simpleEntry struct {
+	key  string
+	used bool
+}
+
 type SimpleCache struct {
 	cacheobjids  map[string]string
-	cachemap     map[string]int
+	cachemap     map[string]*list.Element
+	clock        *list.List
+	hand         *list.Element
 	cachesize    uint64
 	writethrough bool
 	stats        *CacheStats
+	admission    *TinyLFU
 }
 
 func cacheCreateObjKey(obj string) func() string {
@@ -48,7 +57,8 @@ func NewSimpleCache(cachesize uint64, writethrough bool) *SimpleCache {
 	cache.stats = NewCacheStats()
 	cache.writethrough = writethrough
 	cache.cacheobjids = make(map[string]string)
-	cache.cachemap = make(map[string]int)
+	cache.cachemap = make(map[string]*list.Element)
+	cache.clock = list.New()
 
 	godbc.Ensure(cache.cacheobjids != nil)
 	godbc.Ensure(cache.cachemap != nil)
@@ -71,31 +81,44 @@ func (s *SimpleCache) Close() {
 
 }
 
+// Remove the entry, moving the clock hand past it if needed
+func (c *SimpleCache) remove(e *list.Element) {
+	if e == c.hand {
+		c.hand = e.Next()
+	}
+	delete(c.cachemap, e.Value.(*simpleEntry).key)
+	c.clock.Remove(e)
+}
+
 func (c *SimpleCache) Invalidate(chunkkey string) {
-	if _, ok := c.cachemap[chunkkey]; ok {
+	if e, ok := c.cachemap[chunkkey]; ok {
 		c.stats.writehits++
+		c.stats.tenants.writehit()
 		c.stats.invalidations++
-		delete(c.cachemap, chunkkey)
+		c.stats.tenants.invalidate(chunkkey)
+		c.remove(e)
 	}
 }
 
 func (c *SimpleCache) Evict() {
 	c.stats.evictions++
 
-	// BIG ASSUMPTION! I have no idea
-	// if Go keeps track of the iteration
-	// through a map
+	// Clock Algorithm: Walk the ring from the hand,
+	// giving a second chance to entries that were used
 	for {
-		for key, val := range c.cachemap {
-			if val == 1 {
-
-				// Clock Algorithm: We looked at it
-				// and set to zero for next time
-				c.cachemap[key] = 0
-			} else {
-				delete(c.cachemap, key)
-				return
-			}
+		if c.hand == nil {
+			c.hand = c.clock.Front()
+		}
+		entry := c.hand.Value.(*simpleEntry)
+		if entry.used {
+			// We looked at it and set it
+			// to unused for next time
+			entry.used = false
+			c.hand = c.hand.Next()
+		} else {
+			c.stats.tenants.evict(entry.key)
+			c.remove(c.hand)
+			return
 		}
 	}
 }
@@ -106,14 +129,23 @@ func (c *SimpleCache) Insert(chunkkey string) {
 	if uint64(len(c.cachemap)) >= c.cachesize {
 		c.Evict()
 	}
+	c.stats.tenants.insert(chunkkey)
 
-	c.cachemap[chunkkey] = 1
+	// New entries go right behind the hand
+	entry := &simpleEntry{key: chunkkey, used: true}
+	if c.hand == nil {
+		c.cachemap[chunkkey] = c.clock.PushBack(entry)
+	} else {
+		c.cachemap[chunkkey] = c.clock.InsertBefore(entry, c.hand)
+	}
 }
 
 func (c *SimpleCache) Write(obj, chunk string) {
 	c.stats.writes++
+	c.stats.tenants.write()
 
 	key := c.getObjKey(obj) + chunk
+	c.admission.record(key)
 
 	// Invalidate
 	c.Invalidate(key)
@@ -128,21 +160,26 @@ func (c *SimpleCache) Write(obj, chunk string) {
 
 func (c *SimpleCache) Read(obj, chunk string) bool {
 	c.stats.reads++
+	c.stats.tenants.read()
 
 	key := c.getObjKey(obj) + chunk
+	c.admission.record(key)
 
-	if _, ok := c.cachemap[key]; ok {
+	if e, ok := c.cachemap[key]; ok {
 		// Read Hit
 		c.stats.readhits++
+		c.stats.tenants.readhit()
 
 		// Clock Algorithm: Set that we looked
 		// at it
-		c.cachemap[key] = 1
+		e.Value.(*simpleEntry).used = true
 		return true
 	} else {
 		// Read miss
 		// We would do IO here
-		c.Insert(key)
+		if c.admission.admit(key, c.victimKey, c.stats) {
+			c.Insert(key)
+		}
 		return false
 	}
 }
@@ -168,5 +205,46 @@ func (c *SimpleCache) Stats() *CacheStats {
 }
 
 func (c *SimpleCache) StatsClear() {
-	c.stats = NewCacheStats()
+	c.stats.clear()
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *SimpleCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *SimpleCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *SimpleCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *SimpleCache) victimKey() string {
+	if uint64(len(c.cachemap)) < c.cachesize {
+		return ""
+	}
+
+	// Clock Algorithm: The first entry from the hand not used
+	// since the hand passed it.  If all of them were used, the
+	// hand clears them all and comes back to the first one.
+	start := c.hand
+	if start == nil {
+		start = c.clock.Front()
+	}
+	e := start
+	for {
+		if !e.Value.(*simpleEntry).used {
+			return e.Value.(*simpleEntry).key
+		}
+		if e = e.Next(); e == nil {
+			e = c.clock.Front()
+		}
+		if e == start {
+			return start.Value.(*simpleEntry).key
+		}
+	}
 }
@@ -45,25 +45,27 @@ func TestInvalidate(t *testing.T) {
 	assert.Equal(t, 0, c.stats.invalidations)
 
 	// Now insert the key and invalidate
-	c.cachemap["test"] = 1
+	c.Insert("test")
 	c.Invalidate("test")
 	assert.Equal(t, 1, c.stats.writehits)
 	assert.Equal(t, 1, c.stats.invalidations)
 	_, ok = c.cachemap["test"]
 	assert.False(t, ok)
+	assert.Equal(t, 0, c.clock.Len())
 }
 
 func TestEvict(t *testing.T) {
 	c := NewSimpleCache(10, true)
 
-	c.cachemap["test"] = 1
+	c.Insert("test")
 	c.Evict()
 	assert.Equal(t, 1, c.stats.evictions)
 	_, ok := c.cachemap["test"]
 	assert.False(t, ok)
 
-	c.cachemap["thisonestays"] = 1
-	c.cachemap["tobeevicted"] = 0
+	c.Insert("thisonestays")
+	c.Insert("tobeevicted")
+	c.cachemap["tobeevicted"].Value.(*simpleEntry).used = false
 	c.Evict()
 	assert.Equal(t, 2, c.stats.evictions)
 	_, ok = c.cachemap["thisonestays"]
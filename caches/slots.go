@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/lpabon/godbc"
+)
+
+// Fixed array of cache slots like the one of IoCacheBlocks, with
+// the slots linked by index into FIFO queues.  Slots are allocated
+// once and reused, so moving keys between queues needs no memory.
+// prev points to the newer slot in the queue, next to the older.
+
+const noSlot = -1
+
+type slot struct {
+	key        string
+	freq       uint8
+	queue      int
+	prev, next int
+}
+
+type slotQueues struct {
+	slots []slot
+	head  []int
+	tail  []int
+	lens  []uint64
+	free  int
+}
+
+func newSlotQueues(size uint64, queues int) *slotQueues {
+	godbc.Require(size > 0)
+	godbc.Require(queues > 0)
+
+	q := &slotQueues{}
+	q.slots = make([]slot, size)
+	q.head = make([]int, queues)
+	q.tail = make([]int, queues)
+	q.lens = make([]uint64, queues)
+	for i := range q.head {
+		q.head[i] = noSlot
+		q.tail[i] = noSlot
+	}
+
+	// Free slots are linked through next
+	for i := range q.slots {
+		q.slots[i].next = i + 1
+	}
+	q.slots[size-1].next = noSlot
+	q.free = 0
+
+	return q
+}
+
+func (q *slotQueues) len(queue int) uint64 {
+	return q.lens[queue]
+}
+
+// Oldest slot of the queue, or noSlot if it is empty
+func (q *slotQueues) oldest(queue int) int {
+	return q.tail[queue]
+}
+
+// Next newer slot in the queue of slot i, or noSlot
+func (q *slotQueues) newer(i int) int {
+	return q.slots[i].prev
+}
+
+func (q *slotQueues) link(i, queue int) {
+	s := &q.slots[i]
+	s.queue = queue
+	s.prev = noSlot
+	s.next = q.head[queue]
+	if s.next != noSlot {
+		q.slots[s.next].prev = i
+	} else {
+		q.tail[queue] = i
+	}
+	q.head[queue] = i
+	q.lens[queue]++
+}
+
+func (q *slotQueues) unlink(i int) {
+	s := &q.slots[i]
+	if s.prev != noSlot {
+		q.slots[s.prev].next = s.next
+	} else {
+		q.head[s.queue] = s.next
+	}
+	if s.next != noSlot {
+		q.slots[s.next].prev = s.prev
+	} else {
+		q.tail[s.queue] = s.prev
+	}
+	q.lens[s.queue]--
+}
+
+// Put the key in a free slot at the head of the queue
+func (q *slotQueues) push(queue int, key string) int {
+	godbc.Require(q.free != noSlot, "No free slots")
+
+	i := q.free
+	q.free = q.slots[i].next
+	q.slots[i].key = key
+	q.slots[i].freq = 0
+	q.link(i, queue)
+
+	return i
+}
+
+// Move slot i to the head of a queue
+func (q *slotQueues) move(i, queue int) {
+	q.unlink(i)
+	q.link(i, queue)
+}
+
+// Free slot i
+func (q *slotQueues) remove(i int) {
+	q.unlink(i)
+	q.slots[i].key = ""
+	q.slots[i].next = q.free
+	q.free = i
+}
+
+// Put the key in a free slot right behind slot i, on its older
+// side, so it is the last one reached going newer from i
+func (q *slotQueues) pushBehind(i int, key string) int {
+	godbc.Require(q.free != noSlot, "No free slots")
+
+	j := q.free
+	q.free = q.slots[j].next
+
+	s := &q.slots[j]
+	s.key = key
+	s.freq = 0
+	s.queue = q.slots[i].queue
+	s.prev = i
+	s.next = q.slots[i].next
+	if s.next != noSlot {
+		q.slots[s.next].prev = j
+	} else {
+		q.tail[s.queue] = j
+	}
+	q.slots[i].next = j
+	q.lens[s.queue]++
+
+	return j
+}
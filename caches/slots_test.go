@@ -0,0 +1,75 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSlotQueues(t *testing.T) {
+	q := newSlotQueues(3, 2)
+	assert.Equal(t, noSlot, q.oldest(0))
+
+	a := q.push(0, "a")
+	b := q.push(0, "b")
+	c := q.push(1, "c")
+	assert.Equal(t, uint64(2), q.len(0))
+	assert.Equal(t, uint64(1), q.len(1))
+	assert.Equal(t, a, q.oldest(0))
+	assert.Equal(t, b, q.newer(a))
+	assert.Equal(t, noSlot, q.newer(b))
+
+	// No free slots left
+	assert.Panics(t, func() {
+		q.push(0, "d")
+	})
+
+	// Moving a slot puts it at the head of the queue
+	q.move(a, 1)
+	assert.Equal(t, b, q.oldest(0))
+	assert.Equal(t, c, q.oldest(1))
+	assert.Equal(t, a, q.newer(c))
+	assert.Equal(t, 1, q.slots[a].queue)
+
+	// Freed slots are reused
+	q.remove(b)
+	assert.Equal(t, uint64(0), q.len(0))
+	assert.Equal(t, noSlot, q.oldest(0))
+	assert.Equal(t, b, q.push(0, "d"))
+	assert.Equal(t, "d", q.slots[b].key)
+}
+
+func TestSlotQueuesPushBehind(t *testing.T) {
+	q := newSlotQueues(4, 1)
+	a := q.push(0, "a")
+	b := q.push(0, "b")
+
+	// Behind the oldest slot it becomes the oldest
+	c := q.pushBehind(a, "c")
+	assert.Equal(t, c, q.oldest(0))
+	assert.Equal(t, a, q.newer(c))
+
+	// Behind any other slot it goes in between
+	d := q.pushBehind(b, "d")
+	assert.Equal(t, d, q.newer(a))
+	assert.Equal(t, b, q.newer(d))
+	assert.Equal(t, uint64(4), q.len(0))
+
+	assert.Panics(t, func() {
+		q.pushBehind(a, "e")
+	})
+}
@@ -0,0 +1,262 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// Segmented LRU cache as described by Karedla, Love and Wherry in
+// "Caching Strategies to Improve Disk System Performance",
+// IEEE Computer 1994.
+//
+// Keys enter the probationary segment on a miss and are promoted
+// to the protected segment on a hit.  When the protected segment is
+// over its size its LRU key is demoted back to the MRU position of
+// the probationary segment.  Evictions come from the LRU of the
+// probationary segment, so keys seen only once never push out
+// the protected segment.
+
+const (
+	slruProbationary = iota
+	slruProtected
+)
+
+type slruEntry struct {
+	key     string
+	segment int
+}
+
+type SLRUCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]*list.Element
+	objects      *objectIndex
+	segments     [2]*list.List
+	promotions   int
+	demotions    int
+	protected    uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+// protected is the % of the cache used by the protected segment
+func NewSLRUCache(cachesize uint64,
+	writethrough bool,
+	protected int) *SLRUCache {
+
+	godbc.Require(cachesize > 0)
+	godbc.Require(0 <= protected && protected <= 100)
+
+	cache := &SLRUCache{}
+	cache.stats = NewCacheStats()
+	cache.cachemap = make(map[string]*list.Element)
+	cache.objects = newObjectIndex()
+	for i := range cache.segments {
+		cache.segments[i] = list.New()
+	}
+	cache.cachesize = cachesize
+	cache.protected = cachesize * uint64(protected) / 100
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+	godbc.Ensure(cache.protected <= cache.cachesize)
+
+	return cache
+}
+
+func (c *SLRUCache) Close() {
+
+}
+
+func (c *SLRUCache) len(s int) uint64 {
+	return uint64(c.segments[s].Len())
+}
+
+// Move an element to the MRU position of another segment
+func (c *SLRUCache) move(e *list.Element, to int) {
+	entry := e.Value.(*slruEntry)
+	c.segments[entry.segment].Remove(e)
+	entry.segment = to
+	c.cachemap[entry.key] = c.segments[to].PushFront(entry)
+}
+
+// Evict the LRU key of the probationary segment, or of the
+// protected segment if the probationary segment is empty
+func (c *SLRUCache) evict() {
+	c.stats.evictions++
+
+	s := slruProbationary
+	if c.len(slruProbationary) == 0 {
+		s = slruProtected
+	}
+	e := c.segments[s].Back()
+	key := e.Value.(*slruEntry).key
+	c.stats.tenants.evict(key)
+	c.objects.remove(key)
+	delete(c.cachemap, key)
+	c.segments[s].Remove(e)
+}
+
+func (c *SLRUCache) promote(e *list.Element) {
+	c.promotions++
+	c.move(e, slruProtected)
+	if c.len(slruProtected) > c.protected {
+		c.demotions++
+		c.move(c.segments[slruProtected].Back(), slruProbationary)
+	}
+}
+
+func (c *SLRUCache) Invalidate(key string) {
+	if e, ok := c.cachemap[key]; ok {
+		c.stats.writehits++
+		c.stats.tenants.writehit()
+		c.stats.invalidations++
+		c.stats.tenants.invalidate(key)
+		c.segments[e.Value.(*slruEntry).segment].Remove(e)
+		c.objects.remove(key)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *SLRUCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	if uint64(len(c.cachemap)) >= c.cachesize {
+		c.evict()
+	}
+
+	c.cachemap[key] = c.segments[slruProbationary].PushFront(
+		&slruEntry{key: key, segment: slruProbationary})
+}
+
+func (c *SLRUCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *SLRUCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		// Read Hit
+		c.stats.readhits++
+		c.stats.tenants.readhit()
+
+		if e.Value.(*slruEntry).segment == slruProtected {
+			c.segments[slruProtected].MoveToFront(e)
+		} else {
+			c.promote(e)
+		}
+		return true
+	}
+
+	// Read miss
+	// We would do IO here
+	if c.admission.admit(key, c.victimKey, c.stats) {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+	return false
+}
+
+// Free all the cached chunks of the object
+func (c *SLRUCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		e := c.cachemap[key]
+		c.stats.tenants.invalidate(key)
+		c.segments[e.Value.(*slruEntry).segment].Remove(e)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *SLRUCache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"Probationary: %d Protected: %d\n"+
+			"Protected Size: %d\n"+
+			"Promotions to Protected: %d\n"+
+			"Demotions to Probationary: %d\n",
+		float64(len(c.cachemap))/float64(c.cachesize)*100.0,
+		c.len(slruProbationary), c.len(slruProtected),
+		c.protected,
+		c.promotions,
+		c.demotions) +
+		c.stats.String()
+}
+
+func (c *SLRUCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *SLRUCache) StatsClear() {
+	c.stats.clear()
+	c.promotions = 0
+	c.demotions = 0
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *SLRUCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *SLRUCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *SLRUCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *SLRUCache) victimKey() string {
+	if uint64(len(c.cachemap)) < c.cachesize {
+		return ""
+	}
+	s := slruProbationary
+	if c.len(slruProbationary) == 0 {
+		s = slruProtected
+	}
+	return c.segments[s].Back().Value.(*slruEntry).key
+}
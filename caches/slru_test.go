@@ -0,0 +1,128 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestNewSLRUCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewSLRUCache(0, false, 80)
+	})
+	assert.Panics(t, func() {
+		NewSLRUCache(100, false, 101)
+	})
+
+	c := NewSLRUCache(uint64(100), true, 80)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, uint64(80), c.protected)
+	assert.True(t, c.writethrough)
+}
+
+func TestSLRUCachePromotion(t *testing.T) {
+	c := NewSLRUCache(4, false, 50)
+
+	// First access goes to the probationary segment
+	assert.False(t, c.Read("", "a"))
+	assert.Equal(t, uint64(1), c.len(slruProbationary))
+
+	// A hit promotes it to the protected segment
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, uint64(0), c.len(slruProbationary))
+	assert.Equal(t, uint64(1), c.len(slruProtected))
+	assert.Equal(t, 1, c.promotions)
+
+	// A full protected segment demotes its LRU key
+	c.Read("", "b")
+	c.Read("", "b")
+	c.Read("", "c")
+	c.Read("", "c")
+	assert.Equal(t, 3, c.promotions)
+	assert.Equal(t, 1, c.demotions)
+	assert.Equal(t, slruProbationary, c.cachemap["a"].Value.(*slruEntry).segment)
+	assert.Equal(t, uint64(2), c.len(slruProtected))
+	assert.Contains(t, c.String(), "Promotions to Protected: 3")
+	assert.Contains(t, c.String(), "Demotions to Probationary: 1")
+
+	c.StatsClear()
+	assert.Equal(t, 0, c.promotions)
+	assert.Equal(t, 0, c.demotions)
+}
+
+func TestSLRUCacheScanResistance(t *testing.T) {
+	c := NewSLRUCache(4, false, 50)
+
+	for _, key := range []string{"a", "a", "b", "b"} {
+		c.Read("", key)
+	}
+
+	// A long scan only passes through the probationary segment
+	for i := 100; i < 200; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	assert.True(t, c.Read("", "a"))
+	assert.True(t, c.Read("", "b"))
+	assert.Equal(t, uint64(4), uint64(len(c.cachemap)))
+	assert.Equal(t, 98, c.stats.evictions)
+}
+
+func TestSLRUCacheInvalidate(t *testing.T) {
+	c := NewSLRUCache(2, true, 50)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.len(slruProbationary))
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, uint64(1), c.len(slruProbationary))
+
+	c = NewSLRUCache(2, false, 50)
+	c.Read("", "a")
+	c.Read("", "a")
+	c.Write("", "a")
+	assert.Equal(t, uint64(0), c.len(slruProtected))
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestSLRUCacheDelete(t *testing.T) {
+	c := NewSLRUCache(4, false, 50)
+
+	c.Read("a", "1")
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Read("b", "1")
+	assert.Equal(t, uint64(1), c.len(slruProtected))
+
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.len(slruProtected))
+	assert.Equal(t, uint64(1), c.len(slruProbationary))
+	assert.False(t, c.Read("a", "1"))
+	assert.True(t, c.Read("b", "1"))
+
+	c.Delete("c")
+	assert.Equal(t, 1, c.stats.deletionhits)
+
+	c.Delete("a")
+	c.Delete("b")
+	assert.Equal(t, 0, len(c.cachemap))
+	assert.Equal(t, 0, len(c.objects.objs))
+}
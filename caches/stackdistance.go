@@ -0,0 +1,356 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bufio"
+	"container/heap"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"hash/fnv"
+	"io"
+)
+
+const (
+	sdSampleModulus = 1 << 24
+	sdMinCapacity   = 1024
+
+	// Keys are never empty, and never contain NUL
+	sdFree = ""
+	sdHole = "\x00"
+)
+
+// Max heap of access times
+type sdHoles []int
+
+func (h sdHoles) Len() int            { return len(h) }
+func (h sdHoles) Less(i, j int) bool  { return h[i] > h[j] }
+func (h sdHoles) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sdHoles) Push(x interface{}) { *h = append(*h, x.(int)) }
+func (h *sdHoles) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Computes the LRU miss ratio curve for every cache size in a
+// single pass using Mattson's stack distance.  The LRU stack is
+// kept as a Fenwick tree over access times, with one mark at the
+// time of the last access of every key.  The stack distance of a
+// key is the number of marks after its last access.
+//
+// Invalidated keys leave a hole in the stack, which is a free
+// block for every cache large enough to reach it.  The next key
+// moved to the top of the stack from below the hole fills it.
+//
+// For large working sets, keys can be spatially sampled as in
+// SHARDS (Waldspurger et al, FAST 2015).  Only keys whose hash
+// falls under the sample rate are tracked, and their distances
+// are scaled up by 1/rate.
+//
+// Read() reports a hit as if it were an LRU cache of cachesize
+// blocks.  With sampling, the stats only count sampled requests.
+type StackDistance struct {
+	stats        *CacheStats
+	last         map[string]int
+	keys         []string
+	tree         []int
+	holes        sdHoles
+	now          int
+	histogram    []int
+	coldmisses   int
+	samplerate   float64
+	threshold    uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+func NewStackDistance(cachesize uint64, writethrough bool, samplerate float64) *StackDistance {
+	godbc.Require(cachesize > 0)
+	godbc.Require(0 < samplerate && samplerate <= 1)
+
+	c := &StackDistance{}
+	c.stats = NewCacheStats()
+	c.last = make(map[string]int)
+	c.keys = make([]string, sdMinCapacity+1)
+	c.tree = make([]int, sdMinCapacity+1)
+	c.samplerate = samplerate
+	c.threshold = uint64(samplerate * sdSampleModulus)
+	c.cachesize = cachesize
+	c.writethrough = writethrough
+
+	godbc.Ensure(c.cachesize > 0)
+
+	return c
+}
+
+func (c *StackDistance) Close() {
+
+}
+
+func (c *StackDistance) add(t, delta int) {
+	for ; t < len(c.tree); t += t & -t {
+		c.tree[t] += delta
+	}
+}
+
+func (c *StackDistance) sum(t int) int {
+	s := 0
+	for ; t > 0; t -= t & -t {
+		s += c.tree[t]
+	}
+	return s
+}
+
+// Renumber the keys and holes in access order so the tree
+// only needs to be as large as the number of marks
+func (c *StackDistance) compact() {
+	marks := c.sum(c.now)
+	capacity := 2 * marks
+	if capacity < sdMinCapacity {
+		capacity = sdMinCapacity
+	}
+
+	keys := make([]string, capacity+1)
+	now := 0
+	c.holes = c.holes[:0]
+	for t := 1; t <= c.now; t++ {
+		switch c.keys[t] {
+		case sdFree:
+		case sdHole:
+			now++
+			keys[now] = sdHole
+			c.holes = append(c.holes, now)
+		default:
+			now++
+			keys[now] = c.keys[t]
+			c.last[c.keys[t]] = now
+		}
+	}
+	heap.Init(&c.holes)
+
+	// Linear time Fenwick tree build
+	c.tree = make([]int, capacity+1)
+	for t := 1; t <= capacity; t++ {
+		if t <= now {
+			c.tree[t]++
+		}
+		if parent := t + (t & -t); parent <= capacity {
+			c.tree[parent] += c.tree[t]
+		}
+	}
+
+	c.keys = keys
+	c.now = now
+}
+
+func (c *StackDistance) sampled(key string) bool {
+	if c.samplerate == 1 {
+		return true
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+
+	// FNV does not spread short keys well, so finish
+	// with the splitmix64 mixer
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	x = x ^ (x >> 31)
+
+	return x%sdSampleModulus < c.threshold
+}
+
+// Scaled stack distance of a key, or -1 if it is not in the stack
+func (c *StackDistance) distance(key string) int {
+	if t, ok := c.last[key]; ok {
+		return int(float64(c.sum(c.now)-c.sum(t)) / c.samplerate)
+	}
+	return -1
+}
+
+// Invalidate a key, leaving a hole in its place
+func (c *StackDistance) remove(key string) {
+	if t, ok := c.last[key]; ok {
+		c.keys[t] = sdHole
+		heap.Push(&c.holes, t)
+		delete(c.last, key)
+	}
+}
+
+// Move the key to the top of the stack, returning its
+// scaled stack distance or -1 if it was not in the stack
+func (c *StackDistance) access(key string) int {
+	distance := c.distance(key)
+
+	// Position the key is moving from.  New keys come
+	// from below the bottom of the stack.
+	from, ok := c.last[key]
+	if !ok {
+		from = 0
+	}
+
+	if len(c.holes) > 0 && c.holes[0] > from {
+		// Items above the key shift down until the
+		// nearest hole, which fills up.
+		hole := heap.Pop(&c.holes).(int)
+		c.add(hole, -1)
+		c.keys[hole] = sdFree
+		if ok {
+			c.keys[from] = sdHole
+			heap.Push(&c.holes, from)
+		}
+	} else if ok {
+		c.add(from, -1)
+		c.keys[from] = sdFree
+	}
+
+	if c.now+1 >= len(c.tree) {
+		c.compact()
+	}
+	c.now++
+	c.add(c.now, 1)
+	c.keys[c.now] = key
+	c.last[key] = c.now
+
+	return distance
+}
+
+func (c *StackDistance) Write(obj, chunk string) {
+	key := obj + chunk
+	if !c.sampled(key) {
+		return
+	}
+	c.stats.writes++
+
+	if distance := c.distance(key); distance >= 0 && uint64(distance) < c.cachesize {
+		c.stats.writehits++
+		c.stats.invalidations++
+	}
+
+	if c.writethrough {
+		c.access(key)
+	} else {
+		c.remove(key)
+	}
+}
+
+func (c *StackDistance) Read(obj, chunk string) bool {
+	key := obj + chunk
+	if !c.sampled(key) {
+		return false
+	}
+	c.stats.reads++
+
+	distance := c.access(key)
+	if distance < 0 {
+		c.coldmisses++
+		return false
+	}
+
+	for len(c.histogram) <= distance {
+		c.histogram = append(c.histogram, 0)
+	}
+	c.histogram[distance]++
+
+	if uint64(distance) < c.cachesize {
+		c.stats.readhits++
+		return true
+	}
+	return false
+}
+
+func (c *StackDistance) Delete(obj string) {
+	// Not supported
+}
+
+// Read hit rate of an LRU cache with the given number of blocks
+func (c *StackDistance) ReadHitRate(blocks uint64) float64 {
+	if c.stats.reads == 0 {
+		return 0.0
+	}
+
+	hits := 0
+	for distance := 0; distance < len(c.histogram) && uint64(distance) < blocks; distance++ {
+		hits += c.histogram[distance]
+	}
+	return float64(hits) / float64(c.stats.reads)
+}
+
+// Write the miss ratio curve as CSV with the given number of points.
+// The curve covers at least cachesize blocks, and up to the largest
+// stack distance seen.
+func (c *StackDistance) WriteCurve(w io.Writer, blocksize uint32, points int) error {
+	godbc.Require(points > 0)
+
+	maxblocks := uint64(len(c.histogram))
+	if maxblocks < c.cachesize {
+		maxblocks = c.cachesize
+	}
+
+	out := bufio.NewWriter(w)
+	fmt.Fprintf(out, "# cache blocks,cache size MB,read hit rate,read miss ratio\n")
+
+	// Walk the histogram once, accumulating hits
+	hits := 0
+	distance := 0
+	for point := 1; point <= points; point++ {
+		blocks := maxblocks * uint64(point) / uint64(points)
+		if blocks == 0 {
+			continue
+		}
+		for ; distance < len(c.histogram) && uint64(distance) < blocks; distance++ {
+			hits += c.histogram[distance]
+		}
+
+		hitrate := 0.0
+		if c.stats.reads != 0 {
+			hitrate = float64(hits) / float64(c.stats.reads)
+		}
+		fmt.Fprintf(out, "%d,%v,%v,%v\n",
+			blocks,
+			float64(blocks*uint64(blocksize))/(1024*1024),
+			hitrate,
+			1.0-hitrate)
+	}
+
+	return out.Flush()
+}
+
+func (c *StackDistance) String() string {
+	return fmt.Sprintf(
+		"Tracked Blocks: %d\n"+
+			"Sample Rate: %v\n"+
+			"Cold Misses: %d\n"+
+			"Max Stack Distance: %d\n",
+		len(c.last),
+		c.samplerate,
+		c.coldmisses,
+		len(c.histogram)) +
+		c.stats.String()
+}
+
+func (c *StackDistance) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *StackDistance) StatsClear() {
+	c.stats = NewCacheStats()
+	c.histogram = nil
+	c.coldmisses = 0
+}
@@ -0,0 +1,161 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNewStackDistance(t *testing.T) {
+	assert.Panics(t, func() {
+		NewStackDistance(0, false, 1.0)
+	})
+	assert.Panics(t, func() {
+		NewStackDistance(10, false, 0)
+	})
+	assert.Panics(t, func() {
+		NewStackDistance(10, false, 1.5)
+	})
+}
+
+func TestStackDistanceAccess(t *testing.T) {
+	c := NewStackDistance(10, false, 1.0)
+
+	assert.Equal(t, -1, c.access("a"))
+	assert.Equal(t, -1, c.access("b"))
+	assert.Equal(t, -1, c.access("c"))
+	assert.Equal(t, 2, c.access("a"))
+	assert.Equal(t, 0, c.access("a"))
+	assert.Equal(t, 2, c.access("b"))
+
+	// Removed keys leave a hole: [b a hole]
+	c.remove("c")
+	assert.Equal(t, -1, c.distance("c"))
+	assert.Equal(t, 1, c.distance("a"))
+
+	// New key fills the hole: [d b a]
+	assert.Equal(t, -1, c.access("d"))
+	assert.Equal(t, 2, c.distance("a"))
+	assert.Equal(t, 0, len(c.holes))
+
+	// Hole above the key moves to its old position: [a d b]
+	c.remove("b")
+	c.access("e")
+	c.remove("d")
+	assert.Equal(t, 2, c.access("a"))
+	assert.Equal(t, 1, len(c.holes))
+	assert.Equal(t, 1, c.distance("e"))
+}
+
+func TestStackDistanceCompact(t *testing.T) {
+	c := NewStackDistance(10, false, 1.0)
+
+	// Many more accesses than the initial tree size
+	for i := 0; i < 10*sdMinCapacity; i++ {
+		c.access(strconv.Itoa(i % 7))
+	}
+	assert.Equal(t, 6, c.access("6"))
+	assert.Equal(t, 7, len(c.last))
+	assert.True(t, len(c.tree) <= sdMinCapacity+1)
+
+	// Holes survive compaction
+	for i := 0; i < 3; i++ {
+		c.access(strconv.Itoa(i + 10))
+	}
+	c.remove("4")
+	for i := 0; i < 2*sdMinCapacity; i++ {
+		c.access(strconv.Itoa(i%3 + 10))
+	}
+	assert.Equal(t, 1, len(c.holes))
+	assert.Equal(t, 10, c.sum(c.now))
+	assert.Equal(t, 4, c.distance("5"))
+}
+
+// Every point on the curve must match an LRU cache of that size
+func TestStackDistanceMatchesLRU(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	keys := make([]string, 20000)
+	isread := make([]bool, len(keys))
+	for i := range keys {
+		keys[i] = strconv.Itoa(r.Intn(500))
+		isread[i] = r.Intn(100) < 70
+	}
+
+	for _, writethrough := range []bool{true, false} {
+		sd := NewStackDistance(50, writethrough, 1.0)
+		for i := range keys {
+			if isread[i] {
+				sd.Read("", keys[i])
+			} else {
+				sd.Write("", keys[i])
+			}
+		}
+
+		for _, size := range []uint64{1, 10, 50, 100, 400} {
+			lru := NewLRUCache(size, writethrough)
+			for i := range keys {
+				if isread[i] {
+					lru.Read("", keys[i])
+				} else {
+					lru.Write("", keys[i])
+				}
+			}
+			assert.Equal(t, lru.stats.ReadHitRate(), sd.ReadHitRate(size))
+			if size == 50 {
+				assert.Equal(t, lru.stats.readhits, sd.stats.readhits)
+				assert.Equal(t, lru.stats.writehits, sd.stats.writehits)
+			}
+		}
+	}
+}
+
+func TestStackDistanceSampling(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	full := NewStackDistance(100, false, 1.0)
+	sampled := NewStackDistance(100, false, 0.1)
+	for i := 0; i < 500000; i++ {
+		key := strconv.Itoa(r.Intn(20000))
+		full.Read("", key)
+		sampled.Read("", key)
+	}
+
+	assert.True(t, sampled.stats.reads < full.stats.reads)
+	for _, size := range []uint64{2000, 10000, 18000} {
+		assert.InDelta(t, full.ReadHitRate(size), sampled.ReadHitRate(size), 0.05)
+	}
+}
+
+func TestStackDistanceWriteCurve(t *testing.T) {
+	c := NewStackDistance(4, false, 1.0)
+	for i := 0; i < 3; i++ {
+		for _, key := range []string{"a", "b", "c", "d"} {
+			c.Read("", key)
+		}
+	}
+
+	var b bytes.Buffer
+	assert.Nil(t, c.WriteCurve(&b, 1024*1024, 4))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 5, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "#"))
+	assert.Equal(t, "1,1,0,1", lines[1])
+	assert.Equal(t, "4,4,0.6666666666666666,0.33333333333333337", lines[4])
+}
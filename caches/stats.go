@@ -16,8 +16,10 @@
 package caches
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/lpabon/foocsim/utils"
+	"strings"
 )
 
 type CacheStats struct {
@@ -26,9 +28,21 @@ type CacheStats struct {
 	deletions, deletionhits  int
 	evictions, invalidations int
 	insertions               int
+	dirty, destages          int
+	writeabsorptions         int
+	admitted, rejected       int
 	treads                   *utils.TimeDuration
 	tdeletions               *utils.TimeDuration
 	twrites                  *utils.TimeDuration
+	tenants                  *tenantTracker
+	gauges                   []CacheGauge
+}
+
+// Value of the state of a cache type sampled when its stats
+// are taken, like the size of one of its lists
+type CacheGauge struct {
+	Name  string
+	Value uint64
 }
 
 func NewCacheStats() *CacheStats {
@@ -84,12 +98,96 @@ func (c *CacheStats) Copy() *CacheStats {
 	statscopy.tdeletions = c.tdeletions.Copy()
 	statscopy.treads = c.treads.Copy()
 	statscopy.twrites = c.twrites.Copy()
+	statscopy.tenants = c.tenants.copy()
 
 	return statscopy
 }
 
+// Reset the stats.  The blocks owned by each tenant are kept.
+func (c *CacheStats) clear() {
+	tenants := c.tenants
+	*c = *NewCacheStats()
+	tenants.clear()
+	c.tenants = tenants
+}
+
+func (c *CacheStats) setTenants(n int) {
+	if c.tenants == nil || len(c.tenants.stats) != n {
+		c.tenants = newTenantTracker(n)
+	}
+}
+
+// Read misses inserted by the admission policy
+func (c *CacheStats) Admitted() int {
+	return c.admitted
+}
+
+// Read misses not inserted by the admission policy
+func (c *CacheStats) Rejected() int {
+	return c.rejected
+}
+
+// Stats of each tenant, or nil if the tenants are not tracked
+// Gauges of the cache type, or nil if it has none
+func (c *CacheStats) Gauges() []CacheGauge {
+	return c.gauges
+}
+
+func (c *CacheStats) Tenants() []*TenantStats {
+	if c.tenants == nil {
+		return nil
+	}
+	return c.tenants.stats
+}
+
+func (c *CacheStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ReadHitRate      float64             `json:"read_hit_rate"`
+		WriteHitRate     float64             `json:"write_hit_rate"`
+		ReadHits         int                 `json:"read_hits"`
+		WriteHits        int                 `json:"write_hits"`
+		DeletionHits     int                 `json:"deletion_hits"`
+		Reads            int                 `json:"reads"`
+		Writes           int                 `json:"writes"`
+		Deletions        int                 `json:"deletions"`
+		Insertions       int                 `json:"insertions"`
+		Evictions        int                 `json:"evictions"`
+		Invalidations    int                 `json:"invalidations"`
+		Dirty            int                 `json:"dirty"`
+		Destages         int                 `json:"destages"`
+		WriteAbsorptions int                 `json:"write_absorptions"`
+		Admitted         int                 `json:"admitted,omitempty"`
+		Rejected         int                 `json:"rejected,omitempty"`
+		ReadLatency      *utils.TimeDuration `json:"read_latency"`
+		WriteLatency     *utils.TimeDuration `json:"write_latency"`
+		DeleteLatency    *utils.TimeDuration `json:"delete_latency"`
+		Tenants          []*TenantStats      `json:"tenants,omitempty"`
+	}{
+		c.ReadHitRate(),
+		c.WriteHitRate(),
+		c.readhits,
+		c.writehits,
+		c.deletionhits,
+		c.reads,
+		c.writes,
+		c.deletions,
+		c.insertions,
+		c.evictions,
+		c.invalidations,
+		c.dirty,
+		c.destages,
+		c.writeabsorptions,
+		c.admitted,
+		c.rejected,
+		c.treads,
+		c.twrites,
+		c.tdeletions,
+		c.Tenants(),
+	})
+}
+
 func (c *CacheStats) String() string {
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"Read Hit Rate: %.4f\n"+
 			"Write Hit Rate: %.4f\n"+
 			"Read hits: %d\n"+
@@ -101,9 +199,15 @@ func (c *CacheStats) String() string {
 			"Insertions: %d\n"+
 			"Evictions: %d\n"+
 			"Invalidations: %d\n"+
+			"Dirty: %d\n"+
+			"Destages: %d\n"+
+			"Write Absorptions: %d\n"+
 			"Mean Read Latency: %.2f usecs\n"+
 			"Mean Write Latency: %.2f usecs\n"+
-			"Mean Delete Latency: %.2f usecs\n",
+			"Mean Delete Latency: %.2f usecs\n"+
+			"Read Latency: %s\n"+
+			"Write Latency: %s\n"+
+			"Delete Latency: %s\n",
 		c.ReadHitRate(),
 		c.WriteHitRate(),
 		c.readhits,
@@ -115,71 +219,191 @@ func (c *CacheStats) String() string {
 		c.insertions,
 		c.evictions,
 		c.invalidations,
+		c.dirty,
+		c.destages,
+		c.writeabsorptions,
 		c.treads.MeanTimeUsecs(),
 		c.twrites.MeanTimeUsecs(),
-		c.tdeletions.MeanTimeUsecs())
+		c.tdeletions.MeanTimeUsecs(),
+		c.treads.PercentilesString(),
+		c.twrites.PercentilesString(),
+		c.tdeletions.PercentilesString())
+
+	if c.admitted+c.rejected > 0 {
+		s += fmt.Sprintf("Admitted Inserts: %d\n"+
+			"Rejected Inserts: %d\n",
+			c.admitted,
+			c.rejected)
+	}
+
+	for i, t := range c.Tenants() {
+		s += fmt.Sprintf("-- Tenant %d --\n", i) + t.String()
+	}
+
+	return s
 }
 
-func (c *CacheStats) Dump() string {
-	return fmt.Sprintf(
-		"%v,"+ // Read Hit Rate 1
-			"%v,"+ // Write Hit Rate 2
-			"%d,"+ // Read Hits 3
-			"%d,"+ // Write Hits 4
-			"%d,"+ // Deletion Hits 5
-			"%d,"+ // Reads 6
-			"%d,"+ // Writes 7
-			"%d,"+ // Deletions 8
-			"%d,"+ // Insertions 9
-			"%d,"+ // Evictions 10
-			"%d,"+ // Invalidations 11
-			"%v,"+ // Mean Reads 12
-			"%v,"+ // Mean Writes 13
-			"%v\n", // Mean Deletes 14
+// Names of the columns returned by Values and DeltaValues
+var CacheStatsColumns = []string{
+	"read_hit_rate",
+	"write_hit_rate",
+	"read_hits",
+	"write_hits",
+	"deletion_hits",
+	"reads",
+	"writes",
+	"deletions",
+	"insertions",
+	"evictions",
+	"invalidations",
+	"mean_read_usecs",
+	"mean_write_usecs",
+	"mean_delete_usecs",
+	"dirty",
+	"destages",
+	"write_absorptions",
+	"admitted",
+	"rejected",
+	"read_p50_usecs",
+	"read_p90_usecs",
+	"read_p99_usecs",
+	"read_p99.9_usecs",
+	"read_max_usecs",
+	"write_p50_usecs",
+	"write_p90_usecs",
+	"write_p99_usecs",
+	"write_p99.9_usecs",
+	"write_max_usecs",
+	"delete_p50_usecs",
+	"delete_p90_usecs",
+	"delete_p99_usecs",
+	"delete_p99.9_usecs",
+	"delete_max_usecs",
+}
+
+func statsValues(c *CacheStats,
+	readhitrate, writehitrate float64,
+	counters *CacheStats,
+	treads, twrites, tdeletions *utils.TimeDuration) []interface{} {
+
+	values := []interface{}{
+		readhitrate,
+		writehitrate,
+		counters.readhits,
+		counters.writehits,
+		counters.deletionhits,
+		counters.reads,
+		counters.writes,
+		counters.deletions,
+		counters.insertions,
+		counters.evictions,
+		counters.invalidations,
+		treads.MeanTimeUsecs(),
+		twrites.MeanTimeUsecs(),
+		tdeletions.MeanTimeUsecs(),
+		c.dirty, // Dirty is a gauge, not a counter
+		counters.destages,
+		counters.writeabsorptions,
+		counters.admitted,
+		counters.rejected,
+	}
+	for _, t := range []*utils.TimeDuration{treads, twrites, tdeletions} {
+		for _, p := range t.PercentilesUsecs() {
+			values = append(values, p)
+		}
+	}
+
+	return values
+}
+
+// Values of the stats in the order of CacheStatsColumns
+func (c *CacheStats) Values() []interface{} {
+	return statsValues(c,
 		c.ReadHitRate(),
 		c.WriteHitRate(),
-		c.readhits,
-		c.writehits,
-		c.deletionhits,
-		c.reads,
-		c.writes,
-		c.deletions,
-		c.insertions,
-		c.evictions,
-		c.invalidations,
-		c.treads.MeanTimeUsecs(),
-		c.twrites.MeanTimeUsecs(),
-		c.tdeletions.MeanTimeUsecs())
+		c,
+		c.treads, c.twrites, c.tdeletions)
 }
 
-func (c *CacheStats) DumpDelta(prev *CacheStats) string {
-	return fmt.Sprintf(
-		"%v,"+ // Read Hit Rate 1
-			"%v,"+ // Write Hit Rate 2
-			"%d,"+ // Read Hits 3
-			"%d,"+ // Write Hits 4
-			"%d,"+ // Deletion Hits 5
-			"%d,"+ // Reads 6
-			"%d,"+ // Writes 7
-			"%d,"+ // Deletions 8
-			"%d,"+ // Insertions 9
-			"%d,"+ // Evictions 10
-			"%d,"+ // Invalidations 11
-			"%v,"+ // Mean Reads 12
-			"%v,"+ // Mean Writes 13
-			"%v\n", // Mean Deletes 14
+// Values of the stats since prev in the order of CacheStatsColumns
+func (c *CacheStats) DeltaValues(prev *CacheStats) []interface{} {
+	counters := &CacheStats{
+		readhits:         c.readhits - prev.readhits,
+		writehits:        c.writehits - prev.writehits,
+		deletionhits:     c.deletionhits - prev.deletionhits,
+		reads:            c.reads - prev.reads,
+		writes:           c.writes - prev.writes,
+		deletions:        c.deletions - prev.deletions,
+		insertions:       c.insertions - prev.insertions,
+		evictions:        c.evictions - prev.evictions,
+		invalidations:    c.invalidations - prev.invalidations,
+		destages:         c.destages - prev.destages,
+		writeabsorptions: c.writeabsorptions - prev.writeabsorptions,
+		admitted:         c.admitted - prev.admitted,
+		rejected:         c.rejected - prev.rejected,
+	}
+
+	return statsValues(c,
 		c.ReadHitRateDelta(prev),
 		c.WriteHitRateDelta(prev),
-		c.readhits-prev.readhits,
-		c.writehits-prev.writehits,
-		c.deletionhits-prev.deletionhits,
-		c.reads-prev.reads,
-		c.writes-prev.writes,
-		c.deletions-prev.deletions,
-		c.insertions-prev.insertions,
-		c.evictions-prev.evictions,
-		c.invalidations-prev.invalidations,
-		c.treads.DeltaMeanTimeUsecs(prev.treads),
-		c.twrites.DeltaMeanTimeUsecs(prev.twrites),
-		c.tdeletions.DeltaMeanTimeUsecs(prev.tdeletions))
+		counters,
+		c.treads.Delta(prev.treads),
+		c.twrites.Delta(prev.twrites),
+		c.tdeletions.Delta(prev.tdeletions))
+}
+
+// Names of the columns returned by TenantDeltaValues
+func TenantColumns(n int) []string {
+	columns := make([]string, 0, n*5)
+	for i := 0; i < n; i++ {
+		for _, column := range []string{
+			"read_hit_rate",
+			"reads",
+			"blocks",
+			"evictions",
+			"evictions_caused",
+		} {
+			columns = append(columns, fmt.Sprintf("tenant%d_%s", i, column))
+		}
+	}
+
+	return columns
+}
+
+// Values of the stats of each tenant since prev in the order
+// of TenantColumns.  The blocks are the current occupancy.
+func (c *CacheStats) TenantDeltaValues(prev *CacheStats) []interface{} {
+	tenants := c.Tenants()
+	prevtenants := prev.Tenants()
+	values := make([]interface{}, 0, len(tenants)*5)
+	for i, t := range tenants {
+		p := &TenantStats{}
+		if i < len(prevtenants) {
+			p = prevtenants[i]
+		}
+		values = append(values,
+			t.ReadHitRateDelta(p),
+			t.reads-p.reads,
+			t.blocks,
+			t.evictions-p.evictions,
+			t.evictionscaused-p.evictionscaused)
+	}
+
+	return values
+}
+
+func csvLine(values []interface{}) string {
+	fields := make([]string, len(values))
+	for i, v := range values {
+		fields[i] = fmt.Sprint(v)
+	}
+	return strings.Join(fields, ",") + "\n"
+}
+
+func (c *CacheStats) Dump() string {
+	return csvLine(c.Values())
+}
+
+func (c *CacheStats) DumpDelta(prev *CacheStats) string {
+	return csvLine(c.DeltaValues(prev))
 }
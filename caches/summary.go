@@ -0,0 +1,174 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"math"
+)
+
+// Two sided 95% critical values of the t distribution
+// for 1 to 30 degrees of freedom
+var tCritical95 = []float64{
+	12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+func tValue95(df int) float64 {
+	switch {
+	case df <= len(tCritical95):
+		return tCritical95[df-1]
+	case df <= 40:
+		return 2.021
+	case df <= 60:
+		return 2.000
+	case df <= 120:
+		return 1.980
+	default:
+		return 1.960
+	}
+}
+
+// Mean, sample standard deviation and 95% confidence
+// interval of the mean of one stat
+type MetricSummary struct {
+	Mean     float64 `json:"mean"`
+	StdDev   float64 `json:"stddev"`
+	CI95Low  float64 `json:"ci95_low"`
+	CI95High float64 `json:"ci95_high"`
+}
+
+func NewMetricSummary(samples []float64) *MetricSummary {
+	godbc.Require(len(samples) > 0)
+
+	m := &MetricSummary{}
+	n := float64(len(samples))
+	for _, v := range samples {
+		m.Mean += v
+	}
+	m.Mean /= n
+
+	m.CI95Low, m.CI95High = m.Mean, m.Mean
+	if len(samples) > 1 {
+		var sum float64
+		for _, v := range samples {
+			sum += (v - m.Mean) * (v - m.Mean)
+		}
+		m.StdDev = math.Sqrt(sum / (n - 1))
+
+		delta := tValue95(len(samples)-1) * m.StdDev / math.Sqrt(n)
+		m.CI95Low = m.Mean - delta
+		m.CI95High = m.Mean + delta
+	}
+
+	return m
+}
+
+// Summary of the cache stats of independent runs.  Every
+// stat in CacheStatsColumns is summarized.
+type StatsSummary struct {
+	runs    int
+	metrics []*MetricSummary
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	godbc.Check(false, "Unknown stat type", v)
+	return 0
+}
+
+func NewStatsSummary(stats []*CacheStats) *StatsSummary {
+	godbc.Require(len(stats) > 0)
+
+	s := &StatsSummary{}
+	s.runs = len(stats)
+	s.metrics = make([]*MetricSummary, len(CacheStatsColumns))
+
+	values := make([][]interface{}, len(stats))
+	for run := range stats {
+		values[run] = stats[run].Values()
+	}
+	for column := range s.metrics {
+		samples := make([]float64, len(stats))
+		for run := range stats {
+			samples[run] = toFloat(values[run][column])
+		}
+		s.metrics[column] = NewMetricSummary(samples)
+	}
+
+	godbc.Ensure(len(s.metrics) == len(CacheStatsColumns))
+
+	return s
+}
+
+func (s *StatsSummary) Runs() int {
+	return s.runs
+}
+
+// Summary of the stat with this name in CacheStatsColumns
+func (s *StatsSummary) Metric(column string) *MetricSummary {
+	for i, c := range CacheStatsColumns {
+		if c == column {
+			return s.metrics[i]
+		}
+	}
+	return nil
+}
+
+func (s *StatsSummary) MarshalJSON() ([]byte, error) {
+	// Keep the stats in the order of CacheStatsColumns
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "{\"runs\":%d,\"stats\":{", s.runs)
+	for i, m := range s.metrics {
+		jm, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, "%q:%s", CacheStatsColumns[i], jm)
+	}
+	b.WriteString("}}")
+
+	return b.Bytes(), nil
+}
+
+func (s *StatsSummary) String() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Runs: %d\n", s.runs)
+	for i, m := range s.metrics {
+		fmt.Fprintf(&b, "%s: %.4f +/- %.4f (95%% CI %.4f - %.4f)\n",
+			CacheStatsColumns[i],
+			m.Mean,
+			m.StdDev,
+			m.CI95Low,
+			m.CI95High)
+	}
+
+	return b.String()
+}
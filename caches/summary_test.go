@@ -0,0 +1,70 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestMetricSummary(t *testing.T) {
+	m := NewMetricSummary([]float64{5})
+	assert.Equal(t, 5.0, m.Mean)
+	assert.Equal(t, 0.0, m.StdDev)
+	assert.Equal(t, 5.0, m.CI95Low)
+	assert.Equal(t, 5.0, m.CI95High)
+
+	m = NewMetricSummary([]float64{2, 4, 4, 4, 5, 5, 7, 9})
+	assert.Equal(t, 5.0, m.Mean)
+	assert.InDelta(t, 2.1381, m.StdDev, 0.0001)
+
+	// t(7) = 2.365
+	assert.InDelta(t, 5.0-2.365*m.StdDev/2.8284, m.CI95Low, 0.001)
+	assert.InDelta(t, 5.0+2.365*m.StdDev/2.8284, m.CI95High, 0.001)
+
+	assert.Panics(t, func() {
+		NewMetricSummary([]float64{})
+	})
+}
+
+func TestStatsSummary(t *testing.T) {
+	c1 := NewLRUCache(10, true)
+	c1.Read("", "a")
+	c1.Read("", "a")
+
+	c2 := NewLRUCache(10, true)
+	c2.Read("", "a")
+	c2.Read("", "b")
+
+	s := NewStatsSummary([]*CacheStats{c1.Stats(), c2.Stats()})
+	assert.Equal(t, 2, s.Runs())
+	assert.Equal(t, 0.25, s.Metric("read_hit_rate").Mean)
+	assert.Equal(t, 2.0, s.Metric("reads").Mean)
+	assert.Equal(t, 0.0, s.Metric("reads").StdDev)
+	assert.Nil(t, s.Metric("nosuchstat"))
+
+	var j struct {
+		Runs  int                      `json:"runs"`
+		Stats map[string]MetricSummary `json:"stats"`
+	}
+	b, err := json.Marshal(s)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(b, &j))
+	assert.Equal(t, 2, j.Runs)
+	assert.Equal(t, len(CacheStatsColumns), len(j.Stats))
+	assert.Equal(t, 1.5, j.Stats["insertions"].Mean)
+}
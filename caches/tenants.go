@@ -0,0 +1,267 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// Caches which keep stats for each of the tenants sharing them
+type TenantCaches interface {
+	Caches
+
+	// Track the stats of n tenants.  Blocks already in the
+	// cache are kept if the number of tenants is the same.
+	SetTenants(n int)
+
+	// Tenant of the requests which follow
+	SetTenant(tenant int)
+}
+
+// Stats of the requests of one tenant of a shared cache
+type TenantStats struct {
+	reads, readhits   int
+	writes, writehits int
+	insertions        int
+	evictions         int
+	evictionscaused   int
+	blocks            int
+}
+
+// Blocks in the cache owned by the tenant
+func (t *TenantStats) Blocks() int {
+	return t.blocks
+}
+
+func (t *TenantStats) Reads() int {
+	return t.reads
+}
+
+func (t *TenantStats) ReadHits() int {
+	return t.readhits
+}
+
+func (t *TenantStats) ReadMisses() int {
+	return t.reads - t.readhits
+}
+
+// Blocks of the tenant evicted from the cache
+func (t *TenantStats) Evictions() int {
+	return t.evictions
+}
+
+// Evictions needed to insert the blocks of the tenant
+func (t *TenantStats) EvictionsCaused() int {
+	return t.evictionscaused
+}
+
+func (t *TenantStats) ReadHitRate() float64 {
+	if t.reads == 0 {
+		return 0.0
+	}
+	return float64(t.readhits) / float64(t.reads)
+}
+
+func (t *TenantStats) ReadHitRateDelta(prev *TenantStats) float64 {
+	reads := t.reads - prev.reads
+	if reads == 0 {
+		return 0.0
+	}
+	return float64(t.readhits-prev.readhits) / float64(reads)
+}
+
+func (t *TenantStats) WriteHitRate() float64 {
+	if t.writes == 0 {
+		return 0.0
+	}
+	return float64(t.writehits) / float64(t.writes)
+}
+
+func (t *TenantStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ReadHitRate     float64 `json:"read_hit_rate"`
+		WriteHitRate    float64 `json:"write_hit_rate"`
+		ReadHits        int     `json:"read_hits"`
+		ReadMisses      int     `json:"read_misses"`
+		WriteHits       int     `json:"write_hits"`
+		Reads           int     `json:"reads"`
+		Writes          int     `json:"writes"`
+		Insertions      int     `json:"insertions"`
+		Evictions       int     `json:"evictions"`
+		EvictionsCaused int     `json:"evictions_caused"`
+		Blocks          int     `json:"blocks"`
+	}{
+		t.ReadHitRate(),
+		t.WriteHitRate(),
+		t.readhits,
+		t.ReadMisses(),
+		t.writehits,
+		t.reads,
+		t.writes,
+		t.insertions,
+		t.evictions,
+		t.evictionscaused,
+		t.blocks,
+	})
+}
+
+func (t *TenantStats) String() string {
+	return fmt.Sprintf(
+		"Read Hit Rate: %.4f\n"+
+			"Write Hit Rate: %.4f\n"+
+			"Read hits: %d\n"+
+			"Read misses: %d\n"+
+			"Write hits: %d\n"+
+			"Reads: %d\n"+
+			"Writes: %d\n"+
+			"Insertions: %d\n"+
+			"Evictions: %d\n"+
+			"Evictions caused: %d\n"+
+			"Blocks: %d\n",
+		t.ReadHitRate(),
+		t.WriteHitRate(),
+		t.readhits,
+		t.ReadMisses(),
+		t.writehits,
+		t.reads,
+		t.writes,
+		t.insertions,
+		t.evictions,
+		t.evictionscaused,
+		t.blocks)
+}
+
+// Owner of each block in a cache and the stats of each
+// tenant.  All the methods can be called on a nil tracker,
+// which is used when the tenants are not tracked.
+type tenantTracker struct {
+	current int
+	owners  map[string]int
+	stats   []*TenantStats
+}
+
+func newTenantTracker(n int) *tenantTracker {
+	godbc.Require(n > 0)
+
+	t := &tenantTracker{}
+	t.owners = make(map[string]int)
+	t.stats = make([]*TenantStats, n)
+	for i := range t.stats {
+		t.stats[i] = &TenantStats{}
+	}
+
+	return t
+}
+
+func (t *tenantTracker) set(tenant int) {
+	if t == nil {
+		return
+	}
+	godbc.Require(0 <= tenant && tenant < len(t.stats), "Unknown tenant", tenant)
+	t.current = tenant
+}
+
+func (t *tenantTracker) read() {
+	if t != nil {
+		t.stats[t.current].reads++
+	}
+}
+
+func (t *tenantTracker) readhit() {
+	if t != nil {
+		t.stats[t.current].readhits++
+	}
+}
+
+func (t *tenantTracker) write() {
+	if t != nil {
+		t.stats[t.current].writes++
+	}
+}
+
+func (t *tenantTracker) writehit() {
+	if t != nil {
+		t.stats[t.current].writehits++
+	}
+}
+
+// The block is now in the cache, owned by the current tenant
+func (t *tenantTracker) insert(key string) {
+	if t == nil {
+		return
+	}
+	t.stats[t.current].insertions++
+	t.stats[t.current].blocks++
+	t.owners[key] = t.current
+}
+
+func (t *tenantTracker) remove(key string) *TenantStats {
+	owner, ok := t.owners[key]
+	if !ok {
+		// Inserted before the tenants were tracked
+		return nil
+	}
+	delete(t.owners, key)
+	t.stats[owner].blocks--
+
+	return t.stats[owner]
+}
+
+// The block was evicted to make room for the current tenant
+func (t *tenantTracker) evict(key string) {
+	if t == nil {
+		return
+	}
+	if owner := t.remove(key); owner != nil {
+		owner.evictions++
+	}
+	t.stats[t.current].evictionscaused++
+}
+
+func (t *tenantTracker) invalidate(key string) {
+	if t != nil {
+		t.remove(key)
+	}
+}
+
+// Snapshot of the stats of each tenant
+func (t *tenantTracker) copy() *tenantTracker {
+	if t == nil {
+		return nil
+	}
+
+	statscopy := &tenantTracker{}
+	statscopy.current = t.current
+	statscopy.stats = make([]*TenantStats, len(t.stats))
+	for i := range t.stats {
+		s := *t.stats[i]
+		statscopy.stats[i] = &s
+	}
+
+	return statscopy
+}
+
+// Clear the counters but keep the blocks owned by each tenant
+func (t *tenantTracker) clear() {
+	if t == nil {
+		return
+	}
+	for i, s := range t.stats {
+		t.stats[i] = &TenantStats{blocks: s.blocks}
+	}
+}
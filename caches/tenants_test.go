@@ -0,0 +1,146 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestTenantsNotTracked(t *testing.T) {
+	c := NewLRUCache(2, true)
+
+	// Tenants are ignored until they are tracked
+	c.SetTenant(1)
+	c.Read("a", "1")
+	assert.Nil(t, c.Stats().Tenants())
+
+	b, err := json.Marshal(c.Stats())
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(b), "tenants"))
+}
+
+func TestTenantsLRU(t *testing.T) {
+	c := NewLRUCache(2, true)
+	c.SetTenants(2)
+	assert.Panics(t, func() {
+		c.SetTenant(2)
+	})
+
+	// Tenant 0 fills the cache
+	c.SetTenant(0)
+	c.Read("a", "1")
+	c.Read("a", "2")
+	c.Read("a", "1")
+
+	// Tenant 1 evicts a block of tenant 0 and
+	// invalidates the other one
+	c.SetTenant(1)
+	c.Read("b", "1")
+	c.Write("a", "1")
+
+	tenants := c.Stats().Tenants()
+	assert.Equal(t, 2, len(tenants))
+	assert.Equal(t, 3, tenants[0].Reads())
+	assert.Equal(t, 1, tenants[0].ReadHits())
+	assert.Equal(t, 2, tenants[0].ReadMisses())
+	assert.Equal(t, 0, tenants[0].Blocks())
+	assert.Equal(t, 1, tenants[0].Evictions())
+	assert.Equal(t, 0, tenants[0].EvictionsCaused())
+
+	assert.Equal(t, 1, tenants[1].Reads())
+	assert.Equal(t, 1, tenants[1].writehits)
+	assert.Equal(t, 2, tenants[1].Blocks())
+	assert.Equal(t, 0, tenants[1].Evictions())
+	assert.Equal(t, 1, tenants[1].EvictionsCaused())
+
+	// Clearing the stats keeps the owners of the blocks
+	c.StatsClear()
+	tenants = c.Stats().Tenants()
+	assert.Equal(t, 0, tenants[1].Reads())
+	assert.Equal(t, 2, tenants[1].Blocks())
+
+	c.SetTenant(0)
+	c.Read("c", "1")
+	tenants = c.Stats().Tenants()
+	assert.Equal(t, 1, tenants[0].Blocks())
+	assert.Equal(t, 1, tenants[1].Blocks())
+	assert.Equal(t, 1, tenants[1].Evictions())
+
+	// Same number of tenants keeps the owners
+	c.SetTenants(2)
+	assert.Equal(t, 1, c.Stats().Tenants()[0].Blocks())
+	c.SetTenants(3)
+	assert.Equal(t, 0, c.Stats().Tenants()[0].Blocks())
+}
+
+func TestTenantsCaches(t *testing.T) {
+	for _, c := range []TenantCaches{
+		NewSimpleCache(8, true),
+		NewIoCache(8, true),
+		NewLRUCache(8, true),
+		NewARCCache(8, true),
+		NewPartitionedCache(8, true, "weighted", nil, 0),
+	} {
+		c.SetTenants(2)
+		for i := 0; i < 100; i++ {
+			c.SetTenant(i % 2)
+			block := string(rune('a' + i%13))
+			if i%3 == 0 {
+				c.Write("obj", block)
+			} else {
+				c.Read("obj", block)
+			}
+		}
+
+		stats := c.Stats()
+		tenants := stats.Tenants()
+		assert.Equal(t, stats.reads, tenants[0].Reads()+tenants[1].Reads())
+		assert.Equal(t, stats.readhits, tenants[0].ReadHits()+tenants[1].ReadHits())
+		assert.Equal(t, stats.evictions, tenants[0].EvictionsCaused()+tenants[1].EvictionsCaused())
+		assert.Equal(t, stats.evictions, tenants[0].Evictions()+tenants[1].Evictions())
+		assert.True(t, tenants[0].Blocks()+tenants[1].Blocks() <= 8)
+		assert.Equal(t, stats.insertions-stats.evictions-stats.invalidations,
+			tenants[0].Blocks()+tenants[1].Blocks())
+	}
+}
+
+func TestTenantsMetrics(t *testing.T) {
+	c := NewLRUCache(2, true)
+	c.SetTenants(2)
+
+	var b bytes.Buffer
+	m := NewMetricsWriter(&b, "csv")
+	prev := c.Stats()
+	assert.NoError(t, m.Write(0, c.Stats(), prev))
+
+	c.SetTenant(1)
+	c.Read("a", "1")
+	c.Read("a", "1")
+	assert.NoError(t, m.Write(2, c.Stats(), prev))
+	assert.NoError(t, m.Flush())
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Equal(t, 3, len(lines))
+	header := strings.Split(lines[0], ",")
+	assert.Equal(t, 1+len(CacheStatsColumns)+len(TenantColumns(2)), len(header))
+	assert.Equal(t, "tenant1_read_hit_rate", header[len(header)-5])
+	assert.True(t, strings.HasSuffix(lines[2], ",0,0,0,0,0,0.5,2,1,0,0"))
+	assert.Contains(t, c.Stats().String(), "-- Tenant 1 --")
+}
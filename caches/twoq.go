@@ -0,0 +1,286 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"container/list"
+	"fmt"
+	"github.com/lpabon/godbc"
+)
+
+// 2Q cache as described by Johnson and Shasha in "2Q: A Low
+// Overhead High Performance Buffer Management Replacement
+// Algorithm", VLDB 1994.
+//
+// A1in is a FIFO of keys seen once recently, Am an LRU of keys
+// seen again after leaving A1in.  A1out is the ghost FIFO of keys
+// evicted from A1in.  Only A1in and Am hold data.  A miss on a
+// key in A1out promotes it to Am.  Hits in A1in do not change its
+// order, so a scan only passes through A1in.
+
+const (
+	twoqA1in = iota
+	twoqA1out
+	twoqAm
+)
+
+type twoqEntry struct {
+	key  string
+	list int
+}
+
+type TwoQCache struct {
+	stats        *CacheStats
+	admission    *TinyLFU
+	cachemap     map[string]*list.Element
+	objects      *objectIndex
+	lists        [3]*list.List
+	promotions   int
+	kin, kout    uint64
+	cachesize    uint64
+	writethrough bool
+}
+
+// kin is the % of the cache used by A1in, and kout the number of
+// keys remembered by A1out as a % of the cache size
+func NewTwoQCache(cachesize uint64,
+	writethrough bool,
+	kin, kout int) *TwoQCache {
+
+	godbc.Require(cachesize > 0)
+	godbc.Require(0 <= kin && kin <= 100)
+	godbc.Require(kout >= 0)
+
+	cache := &TwoQCache{}
+	cache.stats = NewCacheStats()
+	cache.cachemap = make(map[string]*list.Element)
+	cache.objects = newObjectIndex()
+	for i := range cache.lists {
+		cache.lists[i] = list.New()
+	}
+	cache.cachesize = cachesize
+	cache.kin = cachesize * uint64(kin) / 100
+	cache.kout = cachesize * uint64(kout) / 100
+	cache.writethrough = writethrough
+
+	godbc.Ensure(cache.cachesize > 0)
+	godbc.Ensure(cache.kin <= cache.cachesize)
+
+	return cache
+}
+
+func (c *TwoQCache) Close() {
+
+}
+
+func (c *TwoQCache) len(l int) uint64 {
+	return uint64(c.lists[l].Len())
+}
+
+func (c *TwoQCache) resident() uint64 {
+	return c.len(twoqA1in) + c.len(twoqAm)
+}
+
+// Move an element to the front of another list
+func (c *TwoQCache) move(e *list.Element, to int) {
+	entry := e.Value.(*twoqEntry)
+	c.lists[entry.list].Remove(e)
+	entry.list = to
+	c.cachemap[entry.key] = c.lists[to].PushFront(entry)
+}
+
+// Evict the oldest key of A1in into A1out while A1in is over
+// its size, otherwise the LRU key of Am
+func (c *TwoQCache) reclaim() {
+	c.stats.evictions++
+
+	if c.len(twoqA1in) > c.kin || c.len(twoqAm) == 0 {
+		e := c.lists[twoqA1in].Back()
+		c.stats.tenants.evict(e.Value.(*twoqEntry).key)
+		c.objects.remove(e.Value.(*twoqEntry).key)
+		c.move(e, twoqA1out)
+		for c.len(twoqA1out) > c.kout {
+			e = c.lists[twoqA1out].Back()
+			delete(c.cachemap, e.Value.(*twoqEntry).key)
+			c.lists[twoqA1out].Remove(e)
+		}
+	} else {
+		e := c.lists[twoqAm].Back()
+		c.stats.tenants.evict(e.Value.(*twoqEntry).key)
+		c.objects.remove(e.Value.(*twoqEntry).key)
+		delete(c.cachemap, e.Value.(*twoqEntry).key)
+		c.lists[twoqAm].Remove(e)
+	}
+}
+
+func (c *TwoQCache) Invalidate(key string) {
+	if e, ok := c.cachemap[key]; ok {
+		entry := e.Value.(*twoqEntry)
+		if entry.list != twoqA1out {
+			c.stats.writehits++
+			c.stats.tenants.writehit()
+			c.stats.invalidations++
+			c.stats.tenants.invalidate(key)
+			c.lists[entry.list].Remove(e)
+			c.objects.remove(key)
+			delete(c.cachemap, key)
+		}
+	}
+}
+
+// Insert a key which is not resident.  A key remembered
+// by A1out goes straight to Am.
+func (c *TwoQCache) Insert(key string) {
+	c.stats.insertions++
+	c.stats.tenants.insert(key)
+
+	// Unlink the key from A1out first, so that
+	// reclaim cannot trim it from A1out
+	e, ghost := c.cachemap[key]
+	if ghost {
+		c.lists[twoqA1out].Remove(e)
+		delete(c.cachemap, key)
+	}
+
+	if c.resident() >= c.cachesize {
+		c.reclaim()
+	}
+
+	if ghost {
+		c.promotions++
+		c.cachemap[key] = c.lists[twoqAm].PushFront(&twoqEntry{key: key, list: twoqAm})
+		return
+	}
+
+	c.cachemap[key] = c.lists[twoqA1in].PushFront(&twoqEntry{key: key, list: twoqA1in})
+}
+
+func (c *TwoQCache) Write(obj, chunk string) {
+	c.stats.writes++
+	c.stats.tenants.write()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	// Invalidate
+	c.Invalidate(key)
+
+	// We would do back end IO here
+
+	// Insert
+	if c.writethrough {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+}
+
+func (c *TwoQCache) Read(obj, chunk string) bool {
+	c.stats.reads++
+	c.stats.tenants.read()
+
+	key := obj + chunk
+	c.admission.record(key)
+
+	if e, ok := c.cachemap[key]; ok {
+		switch e.Value.(*twoqEntry).list {
+		case twoqAm:
+			// Read Hit
+			c.stats.readhits++
+			c.stats.tenants.readhit()
+			c.lists[twoqAm].MoveToFront(e)
+			return true
+		case twoqA1in:
+			// Read Hit, but A1in is kept in FIFO order
+			c.stats.readhits++
+			c.stats.tenants.readhit()
+			return true
+		}
+	}
+
+	// Read miss
+	// We would do IO here
+	if c.admission.admit(key, c.victimKey, c.stats) {
+		c.Insert(key)
+		c.objects.add(obj, key)
+	}
+	return false
+}
+
+// Free all the cached chunks of the object.  Keys remembered
+// by A1out are not cached, so they are kept.
+func (c *TwoQCache) Delete(obj string) {
+	c.stats.deletions++
+
+	keys := c.objects.delete(obj)
+	if len(keys) > 0 {
+		c.stats.deletionhits++
+	}
+	for _, key := range keys {
+		e := c.cachemap[key]
+		c.stats.tenants.invalidate(key)
+		c.lists[e.Value.(*twoqEntry).list].Remove(e)
+		delete(c.cachemap, key)
+	}
+}
+
+func (c *TwoQCache) String() string {
+	return fmt.Sprintf(
+		"Cache Utilization: %.2f %%\n"+
+			"A1in: %d A1out: %d Am: %d\n"+
+			"A1in Size (Kin): %d\n"+
+			"A1out Size (Kout): %d\n"+
+			"Promotions from A1out to Am: %d\n",
+		float64(c.resident())/float64(c.cachesize)*100.0,
+		c.len(twoqA1in), c.len(twoqA1out), c.len(twoqAm),
+		c.kin,
+		c.kout,
+		c.promotions) +
+		c.stats.String()
+}
+
+func (c *TwoQCache) Stats() *CacheStats {
+	return c.stats.Copy()
+}
+
+func (c *TwoQCache) StatsClear() {
+	c.stats.clear()
+	c.promotions = 0
+}
+
+// Track the stats of each tenant sharing the cache
+func (c *TwoQCache) SetTenants(n int) {
+	c.stats.setTenants(n)
+}
+
+func (c *TwoQCache) SetTenant(tenant int) {
+	c.stats.tenants.set(tenant)
+}
+
+// Filter the read misses inserted with the admission policy
+func (c *TwoQCache) SetAdmission(admission *TinyLFU) {
+	c.admission = admission
+}
+
+// Key evicted by an insert, or "" if there is room
+func (c *TwoQCache) victimKey() string {
+	if c.resident() < c.cachesize {
+		return ""
+	}
+	if c.len(twoqA1in) > c.kin || c.len(twoqAm) == 0 {
+		return c.lists[twoqA1in].Back().Value.(*twoqEntry).key
+	}
+	return c.lists[twoqAm].Back().Value.(*twoqEntry).key
+}
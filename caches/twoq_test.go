@@ -0,0 +1,145 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caches
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strconv"
+	"testing"
+)
+
+func TestNewTwoQCache(t *testing.T) {
+	assert.Panics(t, func() {
+		NewTwoQCache(0, false, 25, 50)
+	})
+	assert.Panics(t, func() {
+		NewTwoQCache(100, false, 101, 50)
+	})
+
+	c := NewTwoQCache(uint64(100), true, 25, 50)
+	assert.Equal(t, uint64(100), c.cachesize)
+	assert.Equal(t, uint64(25), c.kin)
+	assert.Equal(t, uint64(50), c.kout)
+	assert.True(t, c.writethrough)
+}
+
+func TestTwoQCachePromotion(t *testing.T) {
+	c := NewTwoQCache(4, false, 25, 50)
+
+	// Hits in A1in do not promote
+	assert.False(t, c.Read("", "a"))
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, twoqA1in, c.cachemap["a"].Value.(*twoqEntry).list)
+	assert.Equal(t, 1, c.stats.readhits)
+
+	// A full cache evicts the oldest of A1in into A1out
+	c.Read("", "b")
+	c.Read("", "c")
+	c.Read("", "d")
+	c.Read("", "e")
+	assert.Equal(t, 1, c.stats.evictions)
+	assert.Equal(t, twoqA1out, c.cachemap["a"].Value.(*twoqEntry).list)
+
+	// A miss on A1out promotes the key to Am
+	assert.False(t, c.Read("", "a"))
+	assert.Equal(t, 1, c.promotions)
+	assert.Equal(t, twoqAm, c.cachemap["a"].Value.(*twoqEntry).list)
+	assert.Equal(t, uint64(4), c.resident())
+	assert.Contains(t, c.String(), "Promotions from A1out to Am: 1")
+
+	c.StatsClear()
+	assert.Equal(t, 0, c.promotions)
+}
+
+func TestTwoQCachePromotionFullA1out(t *testing.T) {
+	c := NewTwoQCache(2, false, 50, 50)
+
+	c.Read("", "a")
+	c.Read("", "b")
+	c.Read("", "c")
+	assert.Equal(t, twoqA1out, c.cachemap["a"].Value.(*twoqEntry).list)
+	assert.Equal(t, c.kout, c.len(twoqA1out))
+
+	// Making room pushes b into the full A1out,
+	// which must not forget a on the way
+	assert.False(t, c.Read("", "a"))
+	assert.Equal(t, 1, c.promotions)
+	assert.Equal(t, twoqAm, c.cachemap["a"].Value.(*twoqEntry).list)
+	assert.Equal(t, twoqA1out, c.cachemap["b"].Value.(*twoqEntry).list)
+	assert.Equal(t, uint64(1), c.len(twoqA1out))
+	assert.Equal(t, uint64(2), c.resident())
+}
+
+func TestTwoQCacheScanResistance(t *testing.T) {
+	c := NewTwoQCache(4, false, 25, 50)
+
+	for _, key := range []string{"a", "b", "c", "d", "e", "a"} {
+		c.Read("", key)
+	}
+	assert.Equal(t, twoqAm, c.cachemap["a"].Value.(*twoqEntry).list)
+
+	// A long scan only passes through A1in
+	for i := 100; i < 200; i++ {
+		c.Read("", strconv.Itoa(i))
+	}
+	assert.True(t, c.Read("", "a"))
+	assert.Equal(t, 1, c.promotions)
+	assert.Equal(t, c.kout, c.len(twoqA1out))
+	assert.Equal(t, c.cachesize, c.resident())
+}
+
+func TestTwoQCacheInvalidate(t *testing.T) {
+	c := NewTwoQCache(2, true, 25, 50)
+
+	c.Write("", "a")
+	assert.Equal(t, uint64(1), c.len(twoqA1in))
+	c.Write("", "a")
+	assert.Equal(t, 1, c.stats.writehits)
+	assert.Equal(t, 1, c.stats.invalidations)
+	assert.Equal(t, uint64(1), c.resident())
+
+	c = NewTwoQCache(2, false, 25, 50)
+	c.Read("", "a")
+	c.Write("", "a")
+	assert.Equal(t, uint64(0), c.resident())
+	_, ok := c.cachemap["a"]
+	assert.False(t, ok)
+}
+
+func TestTwoQCacheDelete(t *testing.T) {
+	c := NewTwoQCache(2, false, 50, 50)
+
+	c.Read("a", "1")
+	c.Read("b", "1")
+	c.Read("b", "2")
+	assert.Equal(t, twoqA1out, c.cachemap["a1"].Value.(*twoqEntry).list)
+
+	c.Delete("b")
+	assert.Equal(t, 1, c.stats.deletions)
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.resident())
+
+	// Keys remembered by A1out are kept
+	c.Delete("a")
+	assert.Equal(t, 1, c.stats.deletionhits)
+	assert.False(t, c.Read("a", "1"))
+	assert.Equal(t, twoqAm, c.cachemap["a1"].Value.(*twoqEntry).list)
+
+	c.Delete("a")
+	assert.Equal(t, 2, c.stats.deletionhits)
+	assert.Equal(t, uint64(0), c.resident())
+	assert.Equal(t, 0, len(c.objects.objs))
+}
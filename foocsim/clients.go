@@ -0,0 +1,73 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/foocsim/iogenerator"
+	"io"
+	"text/tabwriter"
+)
+
+// Workload of a client as shown in the clients table
+func clientWorkload(config *args.Args) string {
+	if config.TraceFile() != "" {
+		return "trace:" + config.TraceFile()
+	}
+	return config.Workload()
+}
+
+// Compare the requests of each client which reached the
+// shared cache, to show how the clients affect each other
+func writeClientTable(w io.Writer,
+	configs []*args.Args,
+	apps []*iogenerator.App,
+	cache caches.Caches) error {
+
+	// Occupancy and evictions are only known by
+	// caches which track their tenants
+	tenants := cache.Stats().Tenants()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "\nclient\tworkload\tshare\treads\tread_hits\tread_hit_rate\twrites")
+	if tenants != nil {
+		fmt.Fprint(tw, "\tblocks\tevictions\tevictions_caused")
+	}
+	fmt.Fprintln(tw)
+
+	for app := range apps {
+		stats := apps[app].ClientStatsFor(cache)
+		fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%d\t%.4f\t%d",
+			app,
+			clientWorkload(configs[app]),
+			configs[app].Share(),
+			stats.Reads(),
+			stats.ReadHits(),
+			stats.ReadHitRate(),
+			stats.Writes())
+		if tenants != nil {
+			fmt.Fprintf(tw, "\t%d\t%d\t%d",
+				tenants[app].Blocks(),
+				tenants[app].Evictions(),
+				tenants[app].EvictionsCaused())
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,190 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/foocsim/iogenerator"
+	"github.com/lpabon/foocsim/simulator"
+	"github.com/lpabon/godbc"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+// Stats shown in the comparison table
+var compareColumns = []string{
+	"read_hit_rate",
+	"write_hit_rate",
+	"insertions",
+	"evictions",
+	"invalidations",
+	"mean_read_usecs",
+	"mean_write_usecs",
+}
+
+// Name of the metrics file of one of the compared caches.
+// For example cache.data becomes cache-arc.data
+func compareFile(filename, cachetype string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-" + cachetype + ext
+}
+
+type compareMetrics struct {
+	files   []*os.File
+	writers []*caches.MetricsWriter
+}
+
+func newCompareMetrics(configs []*args.Args, filename string) *compareMetrics {
+	m := &compareMetrics{}
+	for _, config := range configs {
+		fp, err := os.Create(compareFile(filename, config.CacheType()))
+		godbc.Check(err == nil, err)
+
+		m.files = append(m.files, fp)
+		m.writers = append(m.writers, caches.NewMetricsWriter(fp, config.MetricsFormat()))
+	}
+
+	return m
+}
+
+func (m *compareMetrics) Close() {
+	for i := range m.files {
+		err := m.writers[i].Flush()
+		godbc.Check(err == nil, err)
+		m.files[i].Close()
+	}
+}
+
+func printCompareStats(apps []*iogenerator.App, configs []*args.Args, cs []caches.Caches) {
+	// The page caches above each cache see the
+	// same requests, so only show one of them
+	for app := 0; app < len(apps); app++ {
+		fmt.Printf("## App %d ##\n", app)
+		fmt.Print(apps[app])
+	}
+
+	for i := range cs {
+		fmt.Printf("== Cache %s ==\n", configs[i].CacheType())
+		fmt.Print(cs[i])
+
+		if len(apps) > 1 {
+			err := writeClientTable(os.Stdout, configs[i].ClientConfigs(), apps, cs[i])
+			godbc.Check(err == nil, err)
+		}
+	}
+}
+
+func writeCompareTable(w io.Writer, configs []*args.Args, cs []caches.Caches) error {
+	index := make(map[string]int)
+	for i, column := range caches.CacheStatsColumns {
+		index[column] = i
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprint(tw, "\ncachetype")
+	for _, column := range compareColumns {
+		fmt.Fprint(tw, "\t"+column)
+	}
+	fmt.Fprintln(tw)
+
+	for i := range cs {
+		values := cs[i].Stats().Values()
+		fmt.Fprint(tw, configs[i].CacheType())
+		for _, column := range compareColumns {
+			switch v := values[index[column]].(type) {
+			case float64:
+				fmt.Fprintf(tw, "\t%.4f", v)
+			default:
+				fmt.Fprintf(tw, "\t%v", v)
+			}
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
+
+// Send the same request stream to each of the caches being
+// compared, so that differences between them are only due
+// to their policies
+func compare(config *args.Args) {
+	configs := config.CompareConfigs()
+	jsonOutput := config.Output() == "json"
+
+	cs := make([]caches.Caches, len(configs))
+	for i := range configs {
+		cs[i] = simulator.NewCache(configs[i])
+	}
+	sim := simulator.NewWithCaches(config, cs)
+
+	warmups := make([]*StageReport, len(cs))
+	if config.UseWarmup() {
+		// ------------------- WARMUP --------------------
+		metrics := newCompareMetrics(configs, config.WarmupMetricsFile())
+
+		fmt.Fprintln(status, "== Warmup ==")
+		sim.SetMetrics(metrics.writers...)
+		result := sim.Warmup()
+		if config.ShowWarmupStats() {
+			if jsonOutput {
+				for i := range cs {
+					warmups[i] = NewStageReport(result.Caches[i])
+				}
+			} else {
+				printCompareStats(sim.Apps(), configs, cs)
+			}
+		}
+		metrics.Close()
+	}
+
+	// ----------------- SIMULATION ------------------
+	metrics := newCompareMetrics(configs, config.MetricsFile())
+
+	fmt.Fprintln(status, "== Simulation ==")
+	sim.SetMetrics(metrics.writers...)
+	sim.Start()
+	for sim.Step() {
+	}
+	sim.Close()
+	result := sim.Finish()
+	metrics.Close()
+
+	if jsonOutput {
+		r := &CompareReport{
+			Config:      config,
+			Caches:      make([]*Report, len(cs)),
+			Runtime:     result.Runtime.String(),
+			RuntimeSecs: result.Runtime.Seconds(),
+		}
+		for i := range cs {
+			r.Caches[i] = NewReport(configs[i], warmups[i], result.Caches[i], result.Runtime)
+		}
+		err := r.Write(os.Stdout)
+		godbc.Check(err == nil, err)
+		return
+	}
+
+	printCompareStats(sim.Apps(), configs, cs)
+	err := writeCompareTable(os.Stdout, configs, cs)
+	godbc.Check(err == nil, err)
+	fmt.Printf("\nSeed: %d\n", config.Seed())
+	fmt.Print("Total Time: " + result.Runtime.String() + "\n")
+}
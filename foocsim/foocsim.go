@@ -16,15 +16,15 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"github.com/lpabon/foocsim/args"
 	"github.com/lpabon/foocsim/caches"
 	"github.com/lpabon/foocsim/iogenerator"
+	"github.com/lpabon/foocsim/simulator"
 	"github.com/lpabon/godbc"
+	"io"
 	"os"
 	"runtime/pprof"
-	"time"
 )
 
 const (
@@ -34,45 +34,26 @@ const (
 	TB = 1024 * GB
 )
 
-func simulate(config *args.Args, cache caches.Caches, metrics *bufio.Writer, seed int64, printstats bool) {
+// Progress messages.  Moved to stderr when stdout carries
+// a JSON report.
+var status io.Writer = os.Stdout
 
-	// Create applications
-	apps := make([]*iogenerator.App, config.Apps())
+func printStats(config *args.Args, apps []*iogenerator.App, cache caches.Caches) {
+	// Print app stats
 	for app := 0; app < len(apps); app++ {
-		apps[app] = iogenerator.NewApp(config, seed, cache)
+		fmt.Printf("## App %d ##\n", app)
+		fmt.Print(apps[app])
+		fmt.Println("== Cache Requests ==")
+		fmt.Print(apps[app].ClientStatsFor(cache))
 	}
 
-	// Initialize the delta stats
-	prev_stats := cache.Stats()
-	for io := 0; io < config.Ios(); io++ {
+	// Print cache stats
+	fmt.Println("== Cache ==")
+	fmt.Print(cache)
 
-		// Save metrics
-		if (io % (config.DataPeriod())) == 0 {
-			stats := cache.Stats()
-			_, err := metrics.WriteString(fmt.Sprintf("%d,", io) + stats.DumpDelta(prev_stats))
-			godbc.Check(err == nil)
-
-			// Now copy the data
-			prev_stats = stats
-		}
-
-		// Generate I/O for each app
-		for app := 0; app < len(apps); app++ {
-			apps[app].Gen()
-		}
-
-	}
-
-	if printstats {
-		// Print app stats
-		for app := 0; app < len(apps); app++ {
-			fmt.Printf("## App %d ##\n", app)
-			fmt.Print(apps[app])
-		}
-
-		// Print cache stats
-		fmt.Println("== Cache ==")
-		fmt.Print(cache)
+	if len(apps) > 1 {
+		err := writeClientTable(os.Stdout, config.ClientConfigs(), apps, cache)
+		godbc.Check(err == nil, err)
 	}
 }
 
@@ -80,65 +61,110 @@ func main() {
 
 	// Parse flags
 	config := args.NewArgs()
+	jsonOutput := config.Output() == "json"
+	if jsonOutput {
+		status = os.Stderr
+	}
+
+	seed := config.Seed()
 
-	// Setup seed for random numbers
-	seed := time.Now().UnixNano()
+	// Echo the effective configuration
+	if !jsonOutput {
+		fmt.Println("== Configuration ==")
+		fmt.Print(config)
+	}
+
+	// Sweeps, replications and comparisons run
+	// their own simulations
+	if config.Sweep() {
+		sweep(config)
+		return
+	}
+	if config.Replications() > 1 {
+		replicate(config)
+		return
+	}
+	if config.Compare() {
+		compare(config)
+		return
+	}
 
 	// Print here Simulation information, also Mean file size and std deviation
 
 	// Create the cache
 	var cache caches.Caches
-	switch config.CacheType() {
-	case "simple":
-		cache = caches.NewSimpleCache(config.CacheBlocks(), config.Writethrough())
-	case "null":
-		cache = caches.NewNullCache()
-	case "iocache":
-		cache = caches.NewIoCache(config.CacheBlocks(), config.Writethrough())
-	default:
-		// buffer cache = cache size * fbcpercent %
-		cache = caches.NewIoCacheKvDB(config.CacheBlocks(),
-			config.BufferCacheSize(),
+	var mrc *caches.StackDistance
+	if config.MrcFile() != "" {
+		// Miss ratio curve replaces the cache
+		mrc = caches.NewStackDistance(config.CacheBlocks(),
 			config.Writethrough(),
-			config.Blocksize(),
-			config.CacheType())
+			config.MrcSampleRate())
+		cache = mrc
+	} else {
+		cache = simulator.NewCache(config)
 	}
-
-	// Initialize the stats used for delta calculations
+	sim := simulator.NewWithCaches(config, []caches.Caches{cache})
 
 	// Start cpu profiling
 	f, _ := os.Create("cpuprofile")
 	pprof.StartCPUProfile(f)
 	defer pprof.StopCPUProfile()
 
+	var warmup *StageReport
 	if config.UseWarmup() {
 		// ------------------- WARMUP --------------------
 		// Setup file to write cache metrics
-		fp, err := os.Create("cache-warmup.data")
-		godbc.Check(err == nil)
+		fp, err := os.Create(config.WarmupMetricsFile())
+		godbc.Check(err == nil, err)
 		defer fp.Close()
-		metrics := bufio.NewWriter(fp)
-
-		fmt.Println("== Warmup ==")
-		simulate(config, cache, metrics, seed, config.ShowWarmupStats())
-		metrics.Flush()
+		metrics := caches.NewMetricsWriter(fp, config.MetricsFormat())
+
+		fmt.Fprintln(status, "== Warmup ==")
+		sim.SetMetrics(metrics)
+		result := sim.Warmup()
+		if config.ShowWarmupStats() {
+			if jsonOutput {
+				warmup = NewStageReport(result.Caches[0])
+			} else {
+				printStats(config, sim.Apps(), cache)
+			}
+		}
 	}
 
 	// ----------------- SIMULATION ------------------
 	// Setup file to write cache metrics
-	fp, err := os.Create("cache.data")
-	godbc.Check(err == nil)
+	fp, err := os.Create(config.MetricsFile())
+	godbc.Check(err == nil, err)
 	defer fp.Close()
-	metrics := bufio.NewWriter(fp)
+	metrics := caches.NewMetricsWriter(fp, config.MetricsFormat())
 
 	// Begin the simulation
-	fmt.Println("== Simulation ==")
-	cache.StatsClear()
-	start := time.Now()
-	simulate(config, cache, metrics, seed, true /* print stats */)
-	cache.Close()
-	end := time.Now()
-	metrics.Flush()
-
-	fmt.Print("\nTotal Time: " + end.Sub(start).String() + "\n")
+	fmt.Fprintln(status, "== Simulation ==")
+	sim.SetMetrics(metrics)
+	sim.Start()
+	for sim.Step() {
+	}
+	sim.Close()
+	result := sim.Finish()
+
+	if !jsonOutput {
+		printStats(config, sim.Apps(), cache)
+	}
+
+	if mrc != nil {
+		fp, err := os.Create(config.MrcFile())
+		godbc.Check(err == nil, err)
+		defer fp.Close()
+
+		err = mrc.WriteCurve(fp, config.Blocksize(), config.MrcPoints())
+		godbc.Check(err == nil, err)
+	}
+
+	if jsonOutput {
+		err = NewReport(config, warmup, result.Caches[0], result.Runtime).Write(os.Stdout)
+		godbc.Check(err == nil, err)
+	} else {
+		fmt.Printf("\nSeed: %d\n", seed)
+		fmt.Print("Total Time: " + result.Runtime.String() + "\n")
+	}
 }
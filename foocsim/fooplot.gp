@@ -1,34 +1,45 @@
 #!/usr/bin/env gnuplot
 
+# Columns are selected by the names in the header row of cache.data,
+# written with the default -metricsformat=csv
 set terminal png
 set datafile separator ","
 set key right bottom
 set output "cache_readhitrate.png"
-plot "cache.data" using 1:2 every 5 title "Read Hit Rate"
+plot "cache.data" using "io":"read_hit_rate" every 5 title "Read Hit Rate"
 
 set output "cache_writehitrate.png"
-plot "cache.data" using 1:3 every 5 title "Write Hit Rate"
+plot "cache.data" using "io":"write_hit_rate" every 5 title "Write Hit Rate"
 
 set output "cache_reads.png"
-plot "cache.data" using 1:7 every 5 title "Reads", \
-	 "cache.data" using 1:4 every 5 title "Read Hits"
+plot "cache.data" using "io":"reads" every 5 title "Reads", \
+	 "cache.data" using "io":"read_hits" every 5 title "Read Hits"
 
 set output "cache_writes.png"
-plot "cache.data" using 1:8 every 5 title "Writes", \
-     "cache.data" using 1:5 every 5 title "Write Hits"
+plot "cache.data" using "io":"writes" every 5 title "Writes", \
+     "cache.data" using "io":"write_hits" every 5 title "Write Hits"
 
 set output "cache_deletes.png"
-plot "cache.data" using 1:9 every 5 title "Deletions", \
-     "cache.data" using 1:6 every 5 title "Deletion Hits"
+plot "cache.data" using "io":"deletions" every 5 title "Deletions", \
+     "cache.data" using "io":"deletion_hits" every 5 title "Deletion Hits"
 
 set output "cache_evictions.png"
-plot "cache.data" using 1:11 every 5 title "Evictions"
+plot "cache.data" using "io":"evictions" every 5 title "Evictions"
 
 set output "cache_readlatency.png"
-plot "cache.data" using 1:13 every 5 title "Mean Read Latency (usecs)"
+plot "cache.data" using "io":"mean_read_usecs" every 5 title "Mean Read Latency (usecs)"
 
 set output "cache_writelatency.png"
-plot "cache.data" using 1:14 every 5 title "Mean Write Latency (usecs)"
+plot "cache.data" using "io":"mean_write_usecs" every 5 title "Mean Write Latency (usecs)"
 
 set output "cache_deletelatency.png"
-plot "cache.data" using 1:15 every 5 title "Mean Delete Latency (usecs)"
+plot "cache.data" using "io":"mean_delete_usecs" every 5 title "Mean Delete Latency (usecs)"
+
+# Miss ratio curve from -mrc=mrc.data
+if (system("test -f mrc.data && echo 1 || echo 0") == 1) {
+	set key right bottom
+	set xlabel "Cache Size (MB)"
+	set output "cache_mrc.png"
+	plot "mrc.data" using 2:3 with lines title "LRU Read Hit Rate"
+	unset xlabel
+}
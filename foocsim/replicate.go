@@ -0,0 +1,51 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/godbc"
+	"os"
+	"time"
+)
+
+func replicationName(config *args.Args) string {
+	return fmt.Sprintf("seed=%d", config.Seed())
+}
+
+// Repeat the simulation with derived seeds and report the
+// variation of the cache stats between the runs
+func replicate(config *args.Args) {
+	configs := config.ReplicationConfigs()
+
+	fmt.Fprintf(status, "== %d Replications ==\n", len(configs))
+	start := time.Now()
+	reports := runAll(configs, config.SweepParallel(), replicationName)
+	end := time.Now()
+
+	r := NewReplicationReport(config, reports, end.Sub(start))
+	if config.Output() == "json" {
+		err := r.Write(os.Stdout)
+		godbc.Check(err == nil, err)
+		return
+	}
+
+	fmt.Println("== Cache ==")
+	fmt.Print(r.Cache)
+	fmt.Printf("\nSeed: %d\n", config.Seed())
+	fmt.Print("Total Time: " + r.Runtime + "\n")
+}
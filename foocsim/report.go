@@ -0,0 +1,136 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/foocsim/iogenerator"
+	"github.com/lpabon/foocsim/kvdb"
+	"github.com/lpabon/foocsim/simulator"
+	"io"
+	"time"
+)
+
+type AppReport struct {
+	PageCache *caches.CacheStats       `json:"pagecache"`
+	Cache     *iogenerator.ClientStats `json:"cache"`
+}
+
+type StageReport struct {
+	Apps  []AppReport        `json:"apps"`
+	Cache *caches.CacheStats `json:"cache"`
+}
+
+// Results of a run as emitted by -output=json
+type Report struct {
+	Config      *args.Args         `json:"config"`
+	Warmup      *StageReport       `json:"warmup,omitempty"`
+	Apps        []AppReport        `json:"apps"`
+	Cache       *caches.CacheStats `json:"cache"`
+	Kvdb        *kvdb.IoStats      `json:"kvdb,omitempty"`
+	Runtime     string             `json:"runtime"`
+	RuntimeSecs float64            `json:"runtime_secs"`
+}
+
+// Results of -replications as emitted by -output=json
+type ReplicationReport struct {
+	Config      *args.Args           `json:"config"`
+	Seeds       []int64              `json:"seeds"`
+	Cache       *caches.StatsSummary `json:"cache"`
+	Runtime     string               `json:"runtime"`
+	RuntimeSecs float64              `json:"runtime_secs"`
+}
+
+// Results of -compare as emitted by -output=json
+type CompareReport struct {
+	Config      *args.Args `json:"config"`
+	Caches      []*Report  `json:"caches"`
+	Runtime     string     `json:"runtime"`
+	RuntimeSecs float64    `json:"runtime_secs"`
+}
+
+func NewStageReport(result *simulator.CacheResult) *StageReport {
+	s := &StageReport{
+		Apps:  make([]AppReport, len(result.PageCaches)),
+		Cache: result.Stats,
+	}
+	for app := range result.PageCaches {
+		s.Apps[app].PageCache = result.PageCaches[app]
+		s.Apps[app].Cache = result.Clients[app]
+	}
+
+	return s
+}
+
+func NewReport(config *args.Args,
+	warmup *StageReport,
+	result *simulator.CacheResult,
+	runtime time.Duration) *Report {
+
+	stage := NewStageReport(result)
+	r := &Report{
+		Config:      config,
+		Warmup:      warmup,
+		Apps:        stage.Apps,
+		Cache:       stage.Cache,
+		Kvdb:        result.Kvdb,
+		Runtime:     runtime.String(),
+		RuntimeSecs: runtime.Seconds(),
+	}
+
+	return r
+}
+
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func NewReplicationReport(config *args.Args,
+	reports []*Report,
+	runtime time.Duration) *ReplicationReport {
+
+	r := &ReplicationReport{
+		Config:      config,
+		Seeds:       make([]int64, len(reports)),
+		Runtime:     runtime.String(),
+		RuntimeSecs: runtime.Seconds(),
+	}
+
+	stats := make([]*caches.CacheStats, len(reports))
+	for i := range reports {
+		r.Seeds[i] = reports[i].Config.Seed()
+		stats[i] = reports[i].Cache
+	}
+	r.Cache = caches.NewStatsSummary(stats)
+
+	return r
+}
+
+func (r *ReplicationReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *CompareReport) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
@@ -0,0 +1,189 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/foocsim/simulator"
+	"github.com/lpabon/godbc"
+	"io"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// Columns of the sweep summary file
+var sweepColumns = append(append([]string{
+	"cachetype",
+	"cachesize",
+	"blocksize",
+	"pagecachesize",
+}, caches.CacheStatsColumns...), "runtime_secs")
+
+// Caches with an IO backend share their database files and
+// the spc1 generator of goioworkload has global state, so these
+// configurations cannot run at the same time as any other
+func runsAlone(config *args.Args) bool {
+	switch config.CacheType() {
+	case "boltdb", "iodb":
+		return true
+	}
+	for _, client := range config.ClientConfigs() {
+		if client.TraceFile() == "" && client.Workload() == "spc1" {
+			return true
+		}
+	}
+	return false
+}
+
+func sweepName(config *args.Args) string {
+	return fmt.Sprintf("cachetype=%s cachesize=%d blocksize=%d pagecachesize=%d",
+		config.CacheType(),
+		config.CacheSize(),
+		config.BlocksizeKB(),
+		config.PageCacheSize())
+}
+
+// Run the warmup and simulation stages of a single configuration
+// without saving any metrics
+func runQuiet(config *args.Args) *Report {
+	result := simulator.NewFromArgs(config).Run()
+
+	return NewReport(config, nil, result.Caches[0], result.Runtime)
+}
+
+// Run all the configurations, as many at the same time as
+// allowed, and return their reports in the same order
+func runAll(configs []*args.Args, parallel int, name func(*args.Args) string) []*Report {
+	reports := make([]*Report, len(configs))
+
+	var lock sync.Mutex
+	done := 0
+	run := func(i int) {
+		reports[i] = runQuiet(configs[i])
+
+		lock.Lock()
+		defer lock.Unlock()
+		done++
+		fmt.Fprintf(status, "[%d/%d] %s\n", done, len(configs), name(configs[i]))
+	}
+
+	// Each simulation is single threaded, so run
+	// as many as we are allowed at the same time
+	var wg sync.WaitGroup
+	jobs := make(chan int)
+	for worker := 0; worker < parallel; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				run(i)
+			}
+		}()
+	}
+
+	var serial []int
+	for i := range configs {
+		if runsAlone(configs[i]) {
+			serial = append(serial, i)
+		}
+	}
+	if parallel > 1 && len(serial) > 0 {
+		fmt.Fprintf(status, "Warning: %d of %d simulations use the spc1 workload or "+
+			"a cache with an IO backend and run one at a time\n",
+			len(serial), len(configs))
+	}
+	for i := range configs {
+		if !runsAlone(configs[i]) {
+			jobs <- i
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, i := range serial {
+		run(i)
+	}
+
+	return reports
+}
+
+// Run every combination of the sweep parameters and save the
+// final stats of each one to the sweep summary file
+func sweep(config *args.Args) {
+	configs := config.SweepConfigs()
+
+	fmt.Fprintf(status, "== Sweep of %d configurations ==\n", len(configs))
+	reports := runAll(configs, config.SweepParallel(), sweepName)
+
+	// Save summary
+	fp, err := os.Create(config.SweepSummaryFile())
+	godbc.Check(err == nil, err)
+	defer fp.Close()
+
+	table := caches.NewTableWriter(fp, config.MetricsFormat(), sweepColumns)
+	for _, r := range reports {
+		values := []interface{}{
+			r.Config.CacheType(),
+			r.Config.CacheSize(),
+			r.Config.BlocksizeKB(),
+			r.Config.PageCacheSize(),
+		}
+		values = append(values, r.Cache.Values()...)
+		values = append(values, r.RuntimeSecs)
+
+		err = table.WriteRow(values)
+		godbc.Check(err == nil, err)
+	}
+	err = table.Flush()
+	godbc.Check(err == nil, err)
+
+	if config.Output() == "json" {
+		err = writeSweepJson(os.Stdout, reports)
+	} else {
+		err = writeSweepText(os.Stdout, reports)
+	}
+	godbc.Check(err == nil, err)
+
+	if config.Output() != "json" {
+		fmt.Printf("\nSeed: %d\n", config.Seed())
+	}
+}
+
+func writeSweepJson(w io.Writer, reports []*Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
+
+func writeSweepText(w io.Writer, reports []*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nCache Type\tCache GB\tBlock KB\tPage Cache MB\tRead Hit Rate\tWrite Hit Rate\tTime")
+	for _, r := range reports {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.4f\t%.4f\t%s\n",
+			r.Config.CacheType(),
+			r.Config.CacheSize(),
+			r.Config.BlocksizeKB(),
+			r.Config.PageCacheSize(),
+			r.Cache.ReadHitRate(),
+			r.Cache.WriteHitRate(),
+			r.Runtime)
+	}
+	return tw.Flush()
+}
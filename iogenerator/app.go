@@ -19,75 +19,189 @@ import (
 	"fmt"
 	"github.com/lpabon/foocsim/args"
 	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/godbc"
 	"math/rand"
 	"strconv"
 )
 
 type App struct {
-	files            []*File
+	workload         Workload
 	r                *rand.Rand
-	cache            caches.Caches
-	pc               caches.Caches
+	deleter          *rand.Rand
+	caches           []caches.Caches
+	pcs              []caches.Caches
+	tenants          []caches.TenantCaches
+	stats            []*ClientStats
 	deletion_percent int
+	share            int
+	prefix           string
+	client           int
 }
 
 func NewApp(config *args.Args, seed int64, cache caches.Caches) *App {
+	return NewAppCaches(config, seed, []caches.Caches{cache})
+}
+
+// Same as NewApp, but every request is sent to each of the
+// caches.  Each cache has its own page cache above it.
+func NewAppCaches(config *args.Args, seed int64, cs []caches.Caches) *App {
+	godbc.Require(len(cs) > 0)
 
 	app := &App{}
-	app.files = make([]*File, config.Files())
-	app.cache = cache
+	app.caches = cs
 	app.deletion_percent = config.DeletionPercent()
+	app.share = config.Share()
+	app.client = config.Client()
+	if config.PrivateFiles() {
+		app.prefix = strconv.Itoa(config.Client()) + "/"
+	}
 
 	// Create random number for accessing files
 	app.r = rand.New(rand.NewSource(seed))
 
-	// Create page cache
-	if config.PageCacheBlocks() != 0 {
-		app.pc = caches.NewIoCache(config.PageCacheBlocks(), true /* writethrough */)
-	} else {
-		app.pc = caches.NewNullCache()
+	// Deletions have their own generator so that the
+	// deletion percentage does not change the I/O stream
+	app.deleter = rand.New(rand.NewSource(^seed))
+
+	// Tag the requests with the client when the
+	// caches are shared by several clients
+	app.tenants = make([]caches.TenantCaches, len(cs))
+	if config.Apps() > 1 {
+		for i := range cs {
+			if tc, ok := cs[i].(caches.TenantCaches); ok {
+				app.tenants[i] = tc
+			}
+		}
+	}
+
+	// Create page caches
+	app.pcs = make([]caches.Caches, len(cs))
+	app.stats = make([]*ClientStats, len(cs))
+	for i := range app.pcs {
+		app.stats[i] = &ClientStats{}
+		if config.PageCacheBlocks() != 0 {
+			app.pcs[i] = caches.NewIoCache(config.PageCacheBlocks(), true /* writethrough */)
+		} else {
+			app.pcs[i] = caches.NewNullCache()
+		}
+	}
+
+	// Replay a trace instead of generating I/O
+	if config.TraceFile() != "" {
+		app.workload = NewTrace(config.TraceFile(), config.TraceFormat(), config.Blocksize())
+		return app
 	}
 
-	// Create files
-	for file := 0; file < len(app.files); file++ {
-		var size uint64
+	// Determine file sizes
+	sizes := make([]uint64, config.Files())
+	for file := 0; file < len(sizes); file++ {
 		if config.UseRandomFileSize() {
-			size = uint64(app.r.Int63n(int64(config.MaxFileBlocks()))) + uint64(1) // in case we get 0
+			sizes[file] = uint64(app.r.Int63n(int64(config.MaxFileBlocks()))) + uint64(1) // in case we get 0
 		} else {
-			size = config.MaxFileBlocks()
+			sizes[file] = config.MaxFileBlocks()
 		}
-		app.files[file] = NewFile(size, config.ReadPercent())
+	}
+
+	switch config.Workload() {
+	case "spc1":
+		app.workload = NewSpc1Workload(sizes, config.ReadPercent(), app.r)
+	case "zipf":
+		app.workload = NewZipfWorkload(sizes, config.ReadPercent(),
+			config.ZipfS(), config.ZipfV(), seed)
+	case "uniform":
+		app.workload = NewUniformWorkload(sizes, config.ReadPercent(), app.r)
+	case "sequential":
+		app.workload = NewSequentialWorkload(sizes, config.ReadPercent(), app.r)
+	default:
+		godbc.Check(false, "Unknown workload: "+config.Workload())
 	}
 
 	return app
 }
 
+// Generate the share of I/Os of this client
 func (a *App) Gen() {
-	file := a.r.Intn(len(a.files))
-	block, isread := a.files[file].Gen()
+	for i := 0; i < a.share; i++ {
+		a.gen()
+	}
+}
 
-	str_file := strconv.FormatInt(int64(file), 10)
-	str_block := strconv.FormatUint(block, 10)
+func (a *App) gen() {
+	obj, block, isread := a.workload.Gen()
+	obj = a.prefix + obj
+	for _, tc := range a.tenants {
+		if tc != nil {
+			tc.SetTenant(a.client)
+		}
+	}
 
 	// Check if we need to delete this file
-	if rand.Intn(100) < (a.deletion_percent) {
-		a.cache.Delete(str_file)
+	if a.deleter.Intn(100) < (a.deletion_percent) {
+		for i, cache := range a.caches {
+			a.pcs[i].Delete(obj)
+			cache.Delete(obj)
+			a.stats[i].deletions++
+		}
 		return
 	}
 
 	// Which block on the file
+	chunk := strconv.FormatUint(block, 10)
+	for i := range a.caches {
+		a.io(a.pcs[i], a.caches[i], a.stats[i], obj, chunk, isread)
+	}
+}
+
+// Send the I/O through the page cache and then the cache
+func (a *App) io(pc, cache caches.Caches, stats *ClientStats, obj, block string, isread bool) {
 	if isread {
-		if !a.pc.Read(str_file, str_block) {
-			a.cache.Read(str_file, str_block)
+		if !pc.Read(obj, block) {
+			stats.reads++
+			if cache.Read(obj, block) {
+				stats.readhits++
+			}
 		}
 	} else {
-		a.pc.Write(str_file, str_block)
-		a.cache.Write(str_file, str_block)
+		pc.Write(obj, block)
+		cache.Write(obj, block)
+		stats.writes++
+	}
+}
+
+func (a *App) Close() {
+	a.workload.Close()
+}
+
+func (a *App) PageCacheStats() *caches.CacheStats {
+	return a.pcs[0].Stats()
+}
+
+// Stats of the page cache above this cache
+func (a *App) PageCacheStatsFor(cache caches.Caches) *caches.CacheStats {
+	for i := range a.caches {
+		if a.caches[i] == cache {
+			return a.pcs[i].Stats()
+		}
 	}
+
+	godbc.Check(false, "Cache not used by this app")
+	return nil
+}
+
+// Requests of this client which reached the cache
+func (a *App) ClientStatsFor(cache caches.Caches) *ClientStats {
+	for i := range a.caches {
+		if a.caches[i] == cache {
+			return a.stats[i].Copy()
+		}
+	}
+
+	godbc.Check(false, "Cache not used by this app")
+	return nil
 }
 
 func (a *App) String() string {
 
 	return fmt.Sprint("== Page Cache ==\n") +
-		fmt.Sprint(a.pc)
+		fmt.Sprint(a.pcs[0])
 }
@@ -0,0 +1,105 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// Records the objects requested and hits every other read
+type testCache struct {
+	caches.Caches
+	objs  []string
+	reads int
+}
+
+func (c *testCache) Write(obj, chunk string) {
+	c.objs = append(c.objs, obj)
+}
+
+func (c *testCache) Read(obj, chunk string) bool {
+	c.objs = append(c.objs, obj)
+	c.reads++
+	return c.reads%2 == 0
+}
+
+func testApp(t *testing.T, options map[string]string) (*App, *testCache) {
+	a := args.New()
+	for name, value := range options {
+		assert.NoError(t, a.Set(name, value))
+	}
+	assert.NoError(t, a.Check())
+
+	cache := &testCache{Caches: caches.NewNullCache()}
+	configs := a.ClientConfigs()
+	return NewApp(configs[len(configs)-1], 1, cache), cache
+}
+
+func TestAppShare(t *testing.T) {
+	app, cache := testApp(t, map[string]string{
+		"workload": "uniform",
+		"share":    "3",
+	})
+	for i := 0; i < 10; i++ {
+		app.Gen()
+	}
+	assert.Equal(t, 30, len(cache.objs))
+
+	stats := app.ClientStatsFor(cache)
+	assert.Equal(t, 30, stats.Reads()+stats.Writes())
+	assert.Equal(t, cache.reads, stats.Reads())
+	assert.Equal(t, cache.reads/2, stats.ReadHits())
+	assert.Equal(t, float64(cache.reads/2)/float64(cache.reads), stats.ReadHitRate())
+}
+
+func TestAppPrivateFiles(t *testing.T) {
+	app, cache := testApp(t, map[string]string{
+		"workload": "uniform",
+		"clients":  "2",
+	})
+	app.Gen()
+	assert.False(t, strings.Contains(cache.objs[0], "/"))
+
+	app, cache = testApp(t, map[string]string{
+		"workload":     "uniform",
+		"clients":      "2",
+		"privatefiles": "true",
+	})
+	app.Gen()
+	assert.True(t, strings.HasPrefix(cache.objs[0], "1/"))
+}
+
+func TestAppPageCache(t *testing.T) {
+	// Reads which hit the page cache do not reach the cache
+	app, cache := testApp(t, map[string]string{
+		"workload":      "sequential",
+		"reads":         "100",
+		"maxfilesize":   "1",
+		"blocksize":     "64",
+		"pagecachesize": "1",
+	})
+	for i := 0; i < 32; i++ {
+		app.Gen()
+	}
+
+	stats := app.ClientStatsFor(cache)
+	assert.Equal(t, 16, stats.Reads())
+	assert.Equal(t, 16, cache.reads)
+}
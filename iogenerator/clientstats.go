@@ -0,0 +1,88 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Requests of one client which reached a cache shared with
+// other clients, that is, which missed its page cache
+type ClientStats struct {
+	reads, readhits int
+	writes          int
+	deletions       int
+}
+
+func (c *ClientStats) Reads() int {
+	return c.reads
+}
+
+func (c *ClientStats) ReadHits() int {
+	return c.readhits
+}
+
+func (c *ClientStats) Writes() int {
+	return c.writes
+}
+
+func (c *ClientStats) Deletions() int {
+	return c.deletions
+}
+
+func (c *ClientStats) ReadHitRate() float64 {
+	if c.reads == 0 {
+		return 0.0
+	}
+	return float64(c.readhits) / float64(c.reads)
+}
+
+func (c *ClientStats) Copy() *ClientStats {
+	statscopy := &ClientStats{}
+	*statscopy = *c
+	return statscopy
+}
+
+func (c *ClientStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ReadHitRate float64 `json:"read_hit_rate"`
+		ReadHits    int     `json:"read_hits"`
+		Reads       int     `json:"reads"`
+		Writes      int     `json:"writes"`
+		Deletions   int     `json:"deletions"`
+	}{
+		c.ReadHitRate(),
+		c.readhits,
+		c.reads,
+		c.writes,
+		c.deletions,
+	})
+}
+
+func (c *ClientStats) String() string {
+	return fmt.Sprintf(
+		"Read Hit Rate: %.4f\n"+
+			"Read Hits: %d\n"+
+			"Reads: %d\n"+
+			"Writes: %d\n"+
+			"Deletions: %d\n",
+		c.ReadHitRate(),
+		c.readhits,
+		c.reads,
+		c.writes,
+		c.deletions)
+}
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"github.com/lpabon/godbc"
 	"github.com/lpabon/goioworkload/spc1"
+	"os"
 )
 
 type File struct {
@@ -37,7 +38,7 @@ func NewFile(size uint64, readp int) *File {
 	asu3 := uint32(float64(size) * 0.1)
 
 	if !initialized {
-		fmt.Println("Initializing")
+		fmt.Fprintln(os.Stderr, "Initializing")
 		err := spc1.Spc1Init(
 			100,    //bsus: Doesn't matter since we do not use timing
 			1,      //contexts
@@ -51,6 +52,12 @@ func NewFile(size uint64, readp int) *File {
 	return f
 }
 
+// Initialize the spc1 generator again with the next file
+// created, so its I/Os start over for a new simulation
+func ResetSpc1() {
+	initialized = false
+}
+
 func (f *File) Gen() (uint64, bool) {
 	if f.iogen.Blocks <= 0 {
 		f.iogen.Generate()
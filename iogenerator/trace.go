@@ -0,0 +1,197 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/lpabon/godbc"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	SectorSize = 512
+)
+
+// Replays a block I/O trace.  Each request in the trace is split
+// into blocks of the simulation block size.  When the end of
+// the trace is reached, it is replayed from the beginning.
+//
+// Supported formats:
+//
+//	msr:    SNIA MSR Cambridge CSV
+//	        Timestamp,Hostname,DiskNumber,Type,Offset,Size,ResponseTime
+//	        Offset and Size are in bytes.  Type is Read or Write.
+//	simple: op,lba,len
+//	        op is r or w.  lba and len are in 512 byte sectors.
+//
+// Empty lines and lines starting with '#' are ignored.
+type Trace struct {
+	fp        *os.File
+	scanner   *bufio.Scanner
+	parse     func(fields []string) (string, uint64, uint64, bool, error)
+	blocksize uint64
+	line      int
+	records   int
+
+	// Current request being split into blocks
+	obj    string
+	block  uint64
+	blocks uint64
+	isread bool
+}
+
+func NewTrace(path, format string, blocksize uint32) *Trace {
+	godbc.Require(blocksize > 0)
+
+	var err error
+
+	t := &Trace{}
+	t.blocksize = uint64(blocksize)
+
+	switch format {
+	case "msr":
+		t.parse = parseMsr
+	case "simple":
+		t.parse = parseSimple
+	default:
+		godbc.Check(false, "Unknown trace format: "+format)
+	}
+
+	t.fp, err = os.Open(path)
+	godbc.Check(err == nil, err)
+	t.scanner = bufio.NewScanner(t.fp)
+
+	godbc.Ensure(t.fp != nil)
+	godbc.Ensure(t.parse != nil)
+
+	return t
+}
+
+// Returns obj, byte offset, byte length, isread
+func parseMsr(fields []string) (string, uint64, uint64, bool, error) {
+	if len(fields) < 6 {
+		return "", 0, 0, false, fmt.Errorf("expected at least 6 fields, got %d", len(fields))
+	}
+
+	var isread bool
+	switch strings.ToLower(fields[3]) {
+	case "read":
+		isread = true
+	case "write":
+		isread = false
+	default:
+		return "", 0, 0, false, fmt.Errorf("unknown request type %s", fields[3])
+	}
+
+	offset, err := strconv.ParseUint(fields[4], 10, 64)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+	size, err := strconv.ParseUint(fields[5], 10, 64)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+
+	return fields[1] + ":" + fields[2], offset, size, isread, nil
+}
+
+func parseSimple(fields []string) (string, uint64, uint64, bool, error) {
+	if len(fields) != 3 {
+		return "", 0, 0, false, fmt.Errorf("expected 3 fields, got %d", len(fields))
+	}
+
+	var isread bool
+	switch strings.ToLower(fields[0]) {
+	case "r", "read":
+		isread = true
+	case "w", "write":
+		isread = false
+	default:
+		return "", 0, 0, false, fmt.Errorf("unknown op %s", fields[0])
+	}
+
+	lba, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+	sectors, err := strconv.ParseUint(fields[2], 10, 64)
+	if err != nil {
+		return "", 0, 0, false, err
+	}
+
+	return "0", lba * SectorSize, sectors * SectorSize, isread, nil
+}
+
+// Read the next request from the trace
+func (t *Trace) next() {
+	for {
+		if !t.scanner.Scan() {
+			godbc.Check(t.scanner.Err() == nil, t.scanner.Err())
+			godbc.Check(t.records > 0, "Trace has no requests")
+
+			// Replay from the beginning
+			_, err := t.fp.Seek(0, io.SeekStart)
+			godbc.Check(err == nil, err)
+			t.scanner = bufio.NewScanner(t.fp)
+			t.line = 0
+			continue
+		}
+		t.line++
+
+		text := strings.TrimSpace(t.scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		obj, offset, size, isread, err := t.parse(fields)
+		godbc.Check(err == nil, fmt.Sprintf("%s:%d: %v", t.fp.Name(), t.line, err))
+
+		t.obj = obj
+		t.isread = isread
+		t.block = offset / t.blocksize
+		t.blocks = (offset+size+t.blocksize-1)/t.blocksize - t.block
+		if t.blocks == 0 {
+			t.blocks = 1
+		}
+		t.records++
+		return
+	}
+}
+
+func (t *Trace) Gen() (string, uint64, bool) {
+	if t.blocks == 0 {
+		t.next()
+	}
+
+	block := t.block
+	t.block++
+	t.blocks--
+
+	return t.obj, block, t.isread
+}
+
+func (t *Trace) Close() {
+	t.fp.Close()
+}
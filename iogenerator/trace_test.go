@@ -0,0 +1,117 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func tmpTrace(t *testing.T, contents string) string {
+	fp, err := ioutil.TempFile("", "foocsim-trace")
+	assert.Nil(t, err)
+	defer fp.Close()
+
+	_, err = fp.WriteString(contents)
+	assert.Nil(t, err)
+
+	return fp.Name()
+}
+
+func TestTraceMsr(t *testing.T) {
+	path := tmpTrace(t,
+		"128166372003061629,hm,0,Read,8192,8192,2152\n"+
+			"128166372016382155,hm,1,Write,4096,512,1571\n")
+	defer os.Remove(path)
+
+	tr := NewTrace(path, "msr", 4096)
+	defer tr.Close()
+
+	// 8KB read at 8KB is two 4KB blocks
+	obj, block, isread := tr.Gen()
+	assert.Equal(t, "hm:0", obj)
+	assert.Equal(t, uint64(2), block)
+	assert.True(t, isread)
+	obj, block, isread = tr.Gen()
+	assert.Equal(t, "hm:0", obj)
+	assert.Equal(t, uint64(3), block)
+	assert.True(t, isread)
+
+	// Partial block write
+	obj, block, isread = tr.Gen()
+	assert.Equal(t, "hm:1", obj)
+	assert.Equal(t, uint64(1), block)
+	assert.False(t, isread)
+
+	// Replays from the beginning
+	obj, block, isread = tr.Gen()
+	assert.Equal(t, "hm:0", obj)
+	assert.Equal(t, uint64(2), block)
+	assert.True(t, isread)
+}
+
+func TestTraceSimple(t *testing.T) {
+	path := tmpTrace(t,
+		"# op,lba,len\n"+
+			"\n"+
+			"w,0,16\n"+
+			"r, 24, 1\n")
+	defer os.Remove(path)
+
+	tr := NewTrace(path, "simple", 4096)
+	defer tr.Close()
+
+	// 16 sectors at 0 is two 4KB blocks
+	obj, block, isread := tr.Gen()
+	assert.Equal(t, "0", obj)
+	assert.Equal(t, uint64(0), block)
+	assert.False(t, isread)
+	_, block, _ = tr.Gen()
+	assert.Equal(t, uint64(1), block)
+
+	// Sector 24 is in block 3
+	_, block, isread = tr.Gen()
+	assert.Equal(t, uint64(3), block)
+	assert.True(t, isread)
+}
+
+func TestTraceErrors(t *testing.T) {
+	assert.Panics(t, func() {
+		NewTrace("/nonexistent/trace", "simple", 4096)
+	})
+
+	path := tmpTrace(t, "x,1,1\n")
+	defer os.Remove(path)
+	assert.Panics(t, func() {
+		NewTrace(path, "unknown", 4096)
+	})
+
+	tr := NewTrace(path, "simple", 4096)
+	defer tr.Close()
+	assert.Panics(t, func() {
+		tr.Gen()
+	})
+
+	empty := tmpTrace(t, "# nothing\n")
+	defer os.Remove(empty)
+	tr = NewTrace(empty, "simple", 4096)
+	defer tr.Close()
+	assert.Panics(t, func() {
+		tr.Gen()
+	})
+}
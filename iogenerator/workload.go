@@ -0,0 +1,169 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"github.com/lpabon/foocsim/zipfworkload"
+	"github.com/lpabon/godbc"
+	"math/rand"
+	"strconv"
+)
+
+// Source of I/O requests for an App.  Gen returns the object,
+// the block in the object, and if the request is a read.
+type Workload interface {
+	Gen() (string, uint64, bool)
+	Close()
+}
+
+/* -------------------------------------------------------- */
+
+// SPC1-like workload.  Files are picked at random.
+type Spc1Workload struct {
+	files []*File
+	r     *rand.Rand
+}
+
+func NewSpc1Workload(sizes []uint64, readp int, r *rand.Rand) *Spc1Workload {
+	godbc.Require(len(sizes) > 0)
+
+	w := &Spc1Workload{}
+	w.r = r
+	w.files = make([]*File, len(sizes))
+	for file := 0; file < len(w.files); file++ {
+		w.files[file] = NewFile(sizes[file], readp)
+	}
+
+	return w
+}
+
+func (w *Spc1Workload) Gen() (string, uint64, bool) {
+	file := w.r.Intn(len(w.files))
+	block, isread := w.files[file].Gen()
+	return strconv.Itoa(file), block, isread
+}
+
+func (w *Spc1Workload) Close() {
+
+}
+
+/* -------------------------------------------------------- */
+
+// Zipf distribution over all the blocks of all the files.
+// Lower blocks of the lower files are the most popular.
+type ZipfWorkload struct {
+	sizes []uint64
+	zipf  *zipfworkload.ZipfWorkload
+}
+
+func NewZipfWorkload(sizes []uint64, readp int, s, v float64, seed int64) *ZipfWorkload {
+	godbc.Require(len(sizes) > 0)
+
+	var total uint64
+	for _, size := range sizes {
+		total += size
+	}
+
+	w := &ZipfWorkload{}
+	w.sizes = sizes
+	w.zipf = zipfworkload.NewZipfWorkloadsv(total, readp, s, v, seed)
+
+	return w
+}
+
+func (w *ZipfWorkload) Gen() (string, uint64, bool) {
+	block, isread := w.zipf.ZipfGenerate()
+
+	file := 0
+	for block >= w.sizes[file] {
+		block -= w.sizes[file]
+		file++
+	}
+
+	return strconv.Itoa(file), block, isread
+}
+
+func (w *ZipfWorkload) Close() {
+
+}
+
+/* -------------------------------------------------------- */
+
+// Uniformly random file and block
+type UniformWorkload struct {
+	sizes []uint64
+	readp int
+	r     *rand.Rand
+}
+
+func NewUniformWorkload(sizes []uint64, readp int, r *rand.Rand) *UniformWorkload {
+	godbc.Require(len(sizes) > 0)
+	godbc.Require(0 <= readp && readp <= 100)
+
+	return &UniformWorkload{
+		sizes: sizes,
+		readp: readp,
+		r:     r,
+	}
+}
+
+func (w *UniformWorkload) Gen() (string, uint64, bool) {
+	file := w.r.Intn(len(w.sizes))
+	block := uint64(w.r.Int63n(int64(w.sizes[file])))
+	return strconv.Itoa(file), block, w.r.Intn(100) < w.readp
+}
+
+func (w *UniformWorkload) Close() {
+
+}
+
+/* -------------------------------------------------------- */
+
+// Reads every block of every file in order, then starts again
+type SequentialWorkload struct {
+	sizes []uint64
+	readp int
+	r     *rand.Rand
+	file  int
+	block uint64
+}
+
+func NewSequentialWorkload(sizes []uint64, readp int, r *rand.Rand) *SequentialWorkload {
+	godbc.Require(len(sizes) > 0)
+	godbc.Require(0 <= readp && readp <= 100)
+
+	return &SequentialWorkload{
+		sizes: sizes,
+		readp: readp,
+		r:     r,
+	}
+}
+
+func (w *SequentialWorkload) Gen() (string, uint64, bool) {
+	file, block := w.file, w.block
+
+	w.block++
+	if w.block >= w.sizes[w.file] {
+		w.block = 0
+		w.file = (w.file + 1) % len(w.sizes)
+	}
+
+	return strconv.Itoa(file), block, w.r.Intn(100) < w.readp
+}
+
+func (w *SequentialWorkload) Close() {
+
+}
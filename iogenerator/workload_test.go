@@ -0,0 +1,82 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package iogenerator
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func checkRange(t *testing.T, w Workload, sizes []uint64, n int) (reads int) {
+	for i := 0; i < n; i++ {
+		obj, block, isread := w.Gen()
+		file, err := strconv.Atoi(obj)
+		assert.Nil(t, err)
+		assert.True(t, file >= 0 && file < len(sizes))
+		assert.True(t, block < sizes[file])
+		if isread {
+			reads++
+		}
+	}
+	return
+}
+
+func TestUniformWorkload(t *testing.T) {
+	sizes := []uint64{10, 20, 5}
+	w := NewUniformWorkload(sizes, 100, rand.New(rand.NewSource(1)))
+	assert.Equal(t, 1000, checkRange(t, w, sizes, 1000))
+
+	w = NewUniformWorkload(sizes, 0, rand.New(rand.NewSource(1)))
+	assert.Equal(t, 0, checkRange(t, w, sizes, 1000))
+}
+
+func TestSequentialWorkload(t *testing.T) {
+	sizes := []uint64{2, 3}
+	w := NewSequentialWorkload(sizes, 100, rand.New(rand.NewSource(1)))
+
+	expected := []struct {
+		obj   string
+		block uint64
+	}{
+		{"0", 0}, {"0", 1}, {"1", 0}, {"1", 1}, {"1", 2}, {"0", 0},
+	}
+	for _, e := range expected {
+		obj, block, isread := w.Gen()
+		assert.Equal(t, e.obj, obj)
+		assert.Equal(t, e.block, block)
+		assert.True(t, isread)
+	}
+}
+
+func TestZipfWorkload(t *testing.T) {
+	sizes := []uint64{100, 50, 1000}
+	w := NewZipfWorkload(sizes, 50, 1.1, 10, 1)
+	reads := checkRange(t, w, sizes, 10000)
+	assert.True(t, reads > 0 && reads < 10000)
+
+	// Same seed, same stream
+	w1 := NewZipfWorkload(sizes, 50, 1.1, 10, 42)
+	w2 := NewZipfWorkload(sizes, 50, 1.1, 10, 42)
+	for i := 0; i < 100; i++ {
+		obj1, block1, isread1 := w1.Gen()
+		obj2, block2, isread2 := w2.Gen()
+		assert.Equal(t, obj1, obj2)
+		assert.Equal(t, block1, block2)
+		assert.Equal(t, isread1, isread2)
+	}
+}
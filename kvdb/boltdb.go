@@ -71,6 +71,11 @@ func (c *KVBoltDB) Delete(key []byte, index uint64) (err error) {
 	return
 }
 
+func (c *KVBoltDB) Stats() *IoStats {
+	// Not tracked
+	return nil
+}
+
 func (c *KVBoltDB) String() string {
 	return ""
 }
@@ -16,6 +16,7 @@
 package kvdb
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/lpabon/buffercache"
@@ -140,6 +141,32 @@ func (s *IoStats) BufferHitRate() float64 {
 	}
 }
 
+func (s *IoStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		RamHitRate         float64             `json:"ram_hit_rate"`
+		RamHits            uint64              `json:"ram_hits"`
+		BufferHitRate      float64             `json:"buffer_hit_rate"`
+		BufferHits         uint64              `json:"buffer_hits"`
+		StorageHits        uint64              `json:"storage_hits"`
+		Wraps              uint64              `json:"wraps"`
+		SegmentsSkipped    uint64              `json:"segments_skipped"`
+		ReadLatency        *utils.TimeDuration `json:"read_latency"`
+		SegmentReadLatency *utils.TimeDuration `json:"segment_read_latency"`
+		WriteLatency       *utils.TimeDuration `json:"write_latency"`
+	}{
+		s.RamHitRate(),
+		s.ramhits,
+		s.BufferHitRate(),
+		s.bufferhits,
+		s.storagehits,
+		s.wraps,
+		s.seg_skipped,
+		s.readtime,
+		s.segmentreadtime,
+		s.writetime,
+	})
+}
+
 func (s *IoStats) String() string {
 	return fmt.Sprintf("Ram Hit Rate: %.4f\n"+
 		"Ram Hits: %v\n"+
@@ -150,7 +177,10 @@ func (s *IoStats) String() string {
 		"Segments Skipped: %v\n"+
 		"Mean Read Latency: %.2f usec\n"+
 		"Mean Segment Read Latency: %.2f usec\n"+
-		"Mean Write Latency: %.2f usec\n",
+		"Mean Write Latency: %.2f usec\n"+
+		"Read Latency: %s\n"+
+		"Segment Read Latency: %s\n"+
+		"Write Latency: %s\n",
 		s.RamHitRate(),
 		s.ramhits,
 		s.BufferHitRate(),
@@ -160,7 +190,10 @@ func (s *IoStats) String() string {
 		s.seg_skipped,
 		s.readtime.MeanTimeUsecs(),
 		s.segmentreadtime.MeanTimeUsecs(),
-		s.writetime.MeanTimeUsecs()) // + s.readtime.String() + s.writetime.String()
+		s.writetime.MeanTimeUsecs(),
+		s.readtime.PercentilesString(),
+		s.segmentreadtime.PercentilesString(),
+		s.writetime.PercentilesString())
 }
 
 type KVIoDB struct {
@@ -431,6 +464,10 @@ func (c *KVIoDB) Delete(key []byte, index uint64) error {
 	return nil
 }
 
+func (c *KVIoDB) Stats() *IoStats {
+	return c.stats
+}
+
 func (c *KVIoDB) String() string {
 	return fmt.Sprintf(
 		"== IoDB Information ==\n") +
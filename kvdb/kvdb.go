@@ -20,5 +20,6 @@ type Kvdb interface {
 	Put(key, val []byte, index uint64) error
 	Get(key, val []byte, index uint64) error
 	Delete(key []byte, index uint64) error
+	Stats() *IoStats
 	String() string
 }
@@ -0,0 +1,102 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/godbc"
+)
+
+// Run the simulation once with the same seed to capture the
+// request stream seen by the cache.  Used by offline policies.
+func record(config *args.Args) *caches.RequestTrace {
+	recorder := caches.NewRecorderCache()
+	NewWithCaches(config, []caches.Caches{recorder}).Run()
+
+	return recorder.Trace()
+}
+
+// Create the cache of the cache type in the configuration.
+// The configuration must have been checked with args.Check.
+func NewCache(config *args.Args) caches.Caches {
+	var cache caches.Caches
+
+	godbc.Require(config.Check() == nil)
+	switch config.CacheType() {
+	case "simple":
+		cache = caches.NewSimpleCache(config.CacheBlocks(), config.Writethrough())
+	case "null":
+		cache = caches.NewNullCache()
+	case "iocache":
+		if config.WriteBack() {
+			cache = caches.NewIoCacheWriteBack(config.CacheBlocks())
+		} else {
+			cache = caches.NewIoCache(config.CacheBlocks(), config.Writethrough())
+		}
+	case "clockpro":
+		cache = caches.NewClockProCache(config.CacheBlocks(), config.Writethrough())
+	case "lru":
+		cache = caches.NewLRUCache(config.CacheBlocks(), config.Writethrough())
+	case "arc":
+		cache = caches.NewARCCache(config.CacheBlocks(), config.Writethrough())
+	case "2q":
+		cache = caches.NewTwoQCache(config.CacheBlocks(),
+			config.Writethrough(),
+			config.TwoQKin(),
+			config.TwoQKout())
+	case "slru":
+		cache = caches.NewSLRUCache(config.CacheBlocks(),
+			config.Writethrough(),
+			config.SlruProtected())
+	case "lirs":
+		cache = caches.NewLIRSCache(config.CacheBlocks(),
+			config.Writethrough(),
+			config.LirsHir())
+	case "sieve":
+		cache = caches.NewSIEVECache(config.CacheBlocks(), config.Writethrough())
+	case "s3fifo":
+		cache = caches.NewS3FIFOCache(config.CacheBlocks(),
+			config.Writethrough(),
+			config.S3FifoSmall())
+	case "partitioned":
+		cache = caches.NewPartitionedCache(config.CacheBlocks(),
+			config.Writethrough(),
+			config.Partition(),
+			config.PartitionWeights(),
+			config.PartitionReserved())
+	case "opt":
+		cache = caches.NewOptCache(config.CacheBlocks(),
+			config.Writethrough(),
+			record(config))
+	case "boltdb", "iodb":
+		// buffer cache = cache size * fbcpercent %
+		cache = caches.NewIoCacheKvDB(config.CacheBlocks(),
+			config.BufferCacheSize(),
+			config.Writethrough(),
+			config.Blocksize(),
+			config.CacheType())
+	}
+	godbc.Check(cache != nil, "args.CacheTypes lists unknown cache type "+config.CacheType())
+
+	if config.Admission() == "tinylfu" {
+		admission, ok := cache.(caches.AdmissionCaches)
+		godbc.Check(ok, "args.AdmissionCacheTypes lists "+config.CacheType())
+		admission.SetAdmission(caches.NewTinyLFU(config.CacheBlocks()))
+	}
+
+	return cache
+}
@@ -0,0 +1,110 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"fmt"
+	"github.com/lpabon/foocsim/args"
+	"strconv"
+)
+
+// Configuration of a simulation.  NewConfig returns the same
+// defaults as the command line.  Sizes use the same units as
+// the command line options.
+type Config struct {
+	CacheType     string
+	CacheSize     int // GB
+	BlockSize     int // KB
+	PageCacheSize int // MB
+	Writethrough  bool
+	Clients       int
+	Ios           int
+	NumFiles      int
+	MaxFileSize   uint64 // MB
+	ReadPercent   int
+	Workload      string
+	Warmup        bool
+	DataPeriod    int
+	Seed          int64
+
+	// Any other option by its command line flag name,
+	// for example "zipf_s": "1.2"
+	Options map[string]string
+}
+
+func NewConfig() *Config {
+	a := args.New()
+
+	return &Config{
+		CacheType:     a.CacheType(),
+		CacheSize:     a.CacheSize(),
+		BlockSize:     a.BlocksizeKB(),
+		PageCacheSize: a.PageCacheSize(),
+		Writethrough:  a.Writethrough(),
+		Clients:       a.Apps(),
+		Ios:           a.Ios(),
+		NumFiles:      a.Files(),
+		MaxFileSize:   a.MaxFileSize(),
+		ReadPercent:   a.ReadPercent(),
+		Workload:      a.Workload(),
+		Warmup:        a.UseWarmup(),
+		DataPeriod:    a.DataPeriod(),
+		Seed:          a.Seed(),
+		Options:       make(map[string]string),
+	}
+}
+
+// Returns the checked options of this configuration
+func (c *Config) Args() (*args.Args, error) {
+	a := args.New()
+
+	options := map[string]string{
+		"cachetype":     c.CacheType,
+		"cachesize":     strconv.Itoa(c.CacheSize),
+		"blocksize":     strconv.Itoa(c.BlockSize),
+		"pagecachesize": strconv.Itoa(c.PageCacheSize),
+		"writethrough":  strconv.FormatBool(c.Writethrough),
+		"clients":       strconv.Itoa(c.Clients),
+		"ios":           strconv.Itoa(c.Ios),
+		"numfiles":      strconv.Itoa(c.NumFiles),
+		"maxfilesize":   strconv.FormatUint(c.MaxFileSize, 10),
+		"reads":         strconv.Itoa(c.ReadPercent),
+		"workload":      c.Workload,
+		"warmup":        strconv.FormatBool(c.Warmup),
+		"dataperiod":    strconv.Itoa(c.DataPeriod),
+		"seed":          strconv.FormatInt(c.Seed, 10),
+	}
+	for name, value := range c.Options {
+		if _, ok := options[name]; ok {
+			return nil, fmt.Errorf("%s must be set in the Config field", name)
+		}
+		options[name] = value
+	}
+
+	for name, value := range options {
+		err := a.Set(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	err := a.Check()
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
@@ -0,0 +1,275 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package simulator runs the clients of a configuration against
+// one or more caches.  A simulation has an optional warmup stage
+// followed by the measured stage.  Each stage replays the same
+// request stream, generated from the seed of the configuration.
+// The spc1 workload also uses the global rand source, which each
+// stage seeds, so simulations of it must not run at the same time.
+//
+//	config := simulator.NewConfig()
+//	config.CacheType = "arc"
+//	sim, err := simulator.New(config)
+//	if err != nil {
+//		return err
+//	}
+//	result := sim.Run()
+//	fmt.Println(result.Caches[0].Stats.ReadHitRate())
+package simulator
+
+import (
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/lpabon/foocsim/iogenerator"
+	"github.com/lpabon/foocsim/kvdb"
+	"github.com/lpabon/godbc"
+	"io/ioutil"
+	"math/rand"
+	"time"
+)
+
+// Stats of one of the caches at the end of a stage
+type CacheResult struct {
+	Stats *caches.CacheStats
+
+	// Stats of the page cache above this cache
+	// in each client
+	PageCaches []*caches.CacheStats
+
+	// Requests of each client which reached this cache
+	Clients []*iogenerator.ClientStats
+
+	// Only set for caches with an IO backend
+	Kvdb *kvdb.IoStats
+}
+
+// Results of a stage.  Caches are in the same order
+// as given to the simulator.
+type Result struct {
+	Ios     int
+	Caches  []*CacheResult
+	Runtime time.Duration
+}
+
+type Simulator struct {
+	config  *args.Args
+	caches  []caches.Caches
+	apps    []*iogenerator.App
+	metrics []*caches.MetricsWriter
+	prev    []*caches.CacheStats
+	io      int
+	start   time.Time
+	warm    bool
+}
+
+// Create a simulator for the configuration with its cache
+func New(config *Config) (*Simulator, error) {
+	a, err := config.Args()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromArgs(a), nil
+}
+
+// Same as New, but with options which have already been checked
+func NewFromArgs(config *args.Args) *Simulator {
+	return NewWithCaches(config, []caches.Caches{NewCache(config)})
+}
+
+// Create a simulator which sends every request to each of the
+// caches.  The cache type in the configuration is not used.
+func NewWithCaches(config *args.Args, cs []caches.Caches) *Simulator {
+	godbc.Require(config != nil)
+	godbc.Require(len(cs) > 0)
+
+	s := &Simulator{}
+	s.config = config
+	s.caches = cs
+
+	return s
+}
+
+func (s *Simulator) Config() *args.Args {
+	return s.config
+}
+
+func (s *Simulator) Caches() []caches.Caches {
+	return s.caches
+}
+
+// Clients of the current or last stage
+func (s *Simulator) Apps() []*iogenerator.App {
+	return s.apps
+}
+
+// Save metrics of each cache every dataperiod to these writers
+// during the next stage.  One writer is needed for each cache.
+func (s *Simulator) SetMetrics(metrics ...*caches.MetricsWriter) {
+	godbc.Require(len(metrics) == len(s.caches))
+	s.metrics = metrics
+}
+
+func (s *Simulator) begin() {
+	// The spc1 generator keeps its state in its package and
+	// in the global rand source, so both are reset for each
+	// stage to replay the same request stream
+	rand.Seed(s.config.Seed())
+	iogenerator.ResetSpc1()
+
+	// Create applications, each with its own seed
+	// derived from the simulation seed
+	r := rand.New(rand.NewSource(s.config.Seed()))
+	clients := s.config.ClientConfigs()
+	if len(clients) > 1 {
+		for _, cache := range s.caches {
+			if tc, ok := cache.(caches.TenantCaches); ok {
+				tc.SetTenants(len(clients))
+			}
+		}
+	}
+	s.apps = make([]*iogenerator.App, len(clients))
+	for app := 0; app < len(s.apps); app++ {
+		s.apps[app] = iogenerator.NewAppCaches(clients[app], r.Int63(), s.caches)
+	}
+
+	if s.metrics == nil {
+		s.metrics = make([]*caches.MetricsWriter, len(s.caches))
+		for i := range s.metrics {
+			s.metrics[i] = caches.NewMetricsWriter(ioutil.Discard, s.config.MetricsFormat())
+		}
+	}
+
+	// Initialize the delta stats
+	s.prev = make([]*caches.CacheStats, len(s.caches))
+	for i := range s.caches {
+		s.prev[i] = s.caches[i].Stats()
+	}
+
+	s.io = 0
+	s.start = time.Now()
+}
+
+// Begin the measured stage.  The stats of the caches are cleared.
+func (s *Simulator) Start() {
+	for _, cache := range s.caches {
+		cache.StatsClear()
+	}
+	s.begin()
+}
+
+// Generate the next I/O of each client.  Returns false
+// once the stage has generated all of its I/Os.
+func (s *Simulator) Step() bool {
+	godbc.Require(s.apps != nil, "Stage not started")
+
+	if s.io >= s.config.Ios() {
+		return false
+	}
+
+	// Save metrics
+	if (s.io % (s.config.DataPeriod())) == 0 {
+		for i := range s.caches {
+			stats := s.caches[i].Stats()
+			err := s.metrics[i].Write(s.io, stats, s.prev[i])
+			godbc.Check(err == nil, err)
+
+			// Now copy the data
+			s.prev[i] = stats
+		}
+	}
+
+	// Generate I/O for each app
+	for app := 0; app < len(s.apps); app++ {
+		s.apps[app].Gen()
+	}
+	s.io++
+
+	return true
+}
+
+// End the stage and return its results
+func (s *Simulator) Finish() *Result {
+	godbc.Require(s.apps != nil, "Stage not started")
+
+	for app := 0; app < len(s.apps); app++ {
+		s.apps[app].Close()
+	}
+	for _, m := range s.metrics {
+		err := m.Flush()
+		godbc.Check(err == nil, err)
+	}
+	s.metrics = nil
+
+	r := &Result{
+		Ios:     s.io,
+		Caches:  make([]*CacheResult, len(s.caches)),
+		Runtime: time.Since(s.start),
+	}
+	for i, cache := range s.caches {
+		c := &CacheResult{
+			Stats:      cache.Stats(),
+			PageCaches: make([]*caches.CacheStats, len(s.apps)),
+			Clients:    make([]*iogenerator.ClientStats, len(s.apps)),
+		}
+		for app := 0; app < len(s.apps); app++ {
+			c.PageCaches[app] = s.apps[app].PageCacheStatsFor(cache)
+			c.Clients[app] = s.apps[app].ClientStatsFor(cache)
+		}
+
+		// Only caches with an IO backend have kvdb stats
+		if kvcache, ok := cache.(*caches.IoCacheKvDB); ok {
+			c.Kvdb = kvcache.DbStats()
+		}
+		r.Caches[i] = c
+	}
+
+	return r
+}
+
+// Run the whole warmup stage and return its results.
+// The stats are cleared when the next stage starts.
+func (s *Simulator) Warmup() *Result {
+	s.begin()
+	for s.Step() {
+	}
+	s.warm = true
+
+	return s.Finish()
+}
+
+// Run the warmup stage, unless it is disabled in the
+// configuration or has already been run, then run the
+// measured stage and close the caches
+func (s *Simulator) Run() *Result {
+	if s.config.UseWarmup() && !s.warm {
+		s.Warmup()
+	}
+
+	s.Start()
+	for s.Step() {
+	}
+	s.Close()
+
+	return s.Finish()
+}
+
+// Close the caches.  Their stats are still available.
+func (s *Simulator) Close() {
+	for _, cache := range s.caches {
+		cache.Close()
+	}
+}
@@ -0,0 +1,227 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package simulator
+
+import (
+	"bytes"
+	"github.com/lpabon/foocsim/args"
+	"github.com/lpabon/foocsim/caches"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func testConfig() *Config {
+	config := NewConfig()
+	config.CacheType = "lru"
+	config.CacheSize = 1
+	config.BlockSize = 4
+	config.MaxFileSize = 2048
+	config.Workload = "zipf"
+	config.Ios = 2000
+	config.Seed = 1
+	return config
+}
+
+func TestConfigArgs(t *testing.T) {
+	config := testConfig()
+	config.Options["zipf_s"] = "1.5"
+
+	a, err := config.Args()
+	assert.NoError(t, err)
+	assert.Equal(t, "lru", a.CacheType())
+	assert.Equal(t, uint32(4096), a.Blocksize())
+	assert.Equal(t, 1.5, a.ZipfS())
+	assert.Equal(t, int64(1), a.Seed())
+
+	config.Options["zipf_s"] = "0.5"
+	_, err = config.Args()
+	assert.Error(t, err)
+
+	config.Options = map[string]string{"cachetype": "arc"}
+	_, err = config.Args()
+	assert.Error(t, err)
+
+	config.Options = map[string]string{"nosuchoption": "1"}
+	_, err = config.Args()
+	assert.Error(t, err)
+}
+
+func TestNewCache(t *testing.T) {
+	for _, cachetype := range args.CacheTypes {
+		// Cache types with an IO backend create database files
+		if cachetype == "boltdb" || cachetype == "iodb" {
+			continue
+		}
+
+		config := testConfig()
+		config.CacheType = cachetype
+		sim, err := New(config)
+		assert.NoError(t, err, cachetype)
+		assert.Equal(t, 1, len(sim.Caches()), cachetype)
+	}
+
+	// Invalid configurations are errors, not panics
+	config := testConfig()
+	config.CacheType = "bogus"
+	_, err := New(config)
+	assert.Error(t, err)
+
+	config = testConfig()
+	config.Options["writeback"] = "true"
+	_, err = New(config)
+	assert.Error(t, err)
+}
+
+func TestSimulatorRun(t *testing.T) {
+	sim, err := New(testConfig())
+	assert.NoError(t, err)
+
+	r := sim.Run()
+	assert.Equal(t, 2000, r.Ios)
+	assert.Equal(t, 1, len(r.Caches))
+	assert.Equal(t, 1, len(r.Caches[0].PageCaches))
+	assert.Nil(t, r.Caches[0].Kvdb)
+
+	stats := r.Caches[0].Stats
+	assert.True(t, stats.ReadHitRate() > 0)
+
+	// Same seed, same stats
+	sim, err = New(testConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Dump(), sim.Run().Caches[0].Stats.Dump())
+}
+
+func TestSimulatorSpc1(t *testing.T) {
+	// Every stage and the recording of opt see the same
+	// requests from the global state of the spc1 generator
+	config := testConfig()
+	config.CacheType = "opt"
+	config.Workload = "spc1"
+	sim, err := New(config)
+	assert.NoError(t, err)
+	stats := sim.Run().Caches[0].Stats
+	assert.True(t, stats.ReadHitRate() > 0)
+
+	// Same seed, same stats
+	sim, err = New(config)
+	assert.NoError(t, err)
+	assert.Equal(t, stats.Dump(), sim.Run().Caches[0].Stats.Dump())
+}
+
+func TestSimulatorStep(t *testing.T) {
+	config := testConfig()
+	config.Warmup = false
+	config.DataPeriod = 500
+
+	a, err := config.Args()
+	assert.NoError(t, err)
+	sim := NewFromArgs(a)
+
+	var b bytes.Buffer
+	m := caches.NewMetricsWriter(&b, "csv")
+	sim.SetMetrics(m)
+
+	sim.Start()
+	steps := 0
+	for sim.Step() {
+		steps++
+	}
+	assert.False(t, sim.Step())
+	r := sim.Finish()
+	assert.Equal(t, 2000, steps)
+	assert.Equal(t, 2000, r.Ios)
+
+	// Header and one row every dataperiod
+	assert.Equal(t, 5, len(strings.Split(strings.TrimSpace(b.String()), "\n")))
+
+	// Run matches the steps
+	sim = NewFromArgs(a)
+	assert.Equal(t, r.Caches[0].Stats.Dump(), sim.Run().Caches[0].Stats.Dump())
+}
+
+func TestSimulatorCaches(t *testing.T) {
+	a, err := testConfig().Args()
+	assert.NoError(t, err)
+
+	lru := caches.NewLRUCache(a.CacheBlocks(), true)
+	arc := caches.NewARCCache(a.CacheBlocks(), true)
+	r := NewWithCaches(a, []caches.Caches{lru, arc}).Run()
+	assert.Equal(t, 2, len(r.Caches))
+
+	// Every cache sees the same requests
+	lruStats := r.Caches[0].Stats.Values()
+	arcStats := r.Caches[1].Stats.Values()
+	for i, column := range caches.CacheStatsColumns {
+		if column == "reads" || column == "writes" {
+			assert.Equal(t, lruStats[i], arcStats[i])
+		}
+	}
+
+	// The lru cache alone gets the same stats
+	single, err := New(testConfig())
+	assert.NoError(t, err)
+	assert.Equal(t, single.Run().Caches[0].Stats.Dump(), r.Caches[0].Stats.Dump())
+}
+
+func TestSimulatorTenants(t *testing.T) {
+	sim, err := New(testConfig())
+	assert.NoError(t, err)
+	assert.Nil(t, sim.Run().Caches[0].Stats.Tenants())
+
+	config := testConfig()
+	config.Clients = 2
+	sim, err = New(config)
+	assert.NoError(t, err)
+
+	r := sim.Run()
+	tenants := r.Caches[0].Stats.Tenants()
+	assert.Equal(t, 2, len(tenants))
+	for i, tenant := range tenants {
+		assert.Equal(t, r.Caches[0].Clients[i].Reads(), tenant.Reads())
+		assert.Equal(t, r.Caches[0].Clients[i].ReadHits(), tenant.ReadHits())
+	}
+}
+
+func TestSimulatorAdmission(t *testing.T) {
+	config := testConfig()
+	config.BlockSize = 1024
+	config.MaxFileSize = 64 * 1024
+	config.Ios = 20000
+	config.Warmup = false
+	config.Options = map[string]string{"admission": "tinylfu"}
+	sim, err := New(config)
+	assert.NoError(t, err)
+
+	stats := sim.Run().Caches[0].Stats
+	assert.True(t, stats.Admitted() > 0)
+	assert.True(t, stats.Rejected() > 0)
+	assert.Contains(t, stats.String(), "Rejected Inserts: ")
+
+	config.CacheType = "opt"
+	_, err = New(config)
+	assert.Error(t, err)
+
+	// Every cache type listed supports admission
+	for _, cachetype := range args.AdmissionCacheTypes {
+		if cachetype == "boltdb" || cachetype == "iodb" {
+			continue
+		}
+		config.CacheType = cachetype
+		_, err = New(config)
+		assert.NoError(t, err, cachetype)
+	}
+}
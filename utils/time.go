@@ -16,18 +16,63 @@
 package utils
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"math/bits"
 	"time"
 )
 
+// Latencies are kept in a log bucketed histogram, like HdrHistogram.
+// Every power of two is split into 16 linear sub-buckets, so any
+// value is within 1/16th (6.25%) of the bucket it is recorded in.
+// Values under 16ns are exact.
+const (
+	tdSubBucketBits = 4
+	tdSubBuckets    = 1 << tdSubBucketBits
+	tdBuckets       = (64 - tdSubBucketBits) * tdSubBuckets
+)
+
 type TimeDuration struct {
 	duration int64
 	counter  int64
+	max      int64
+	buckets  [tdBuckets]int64
+}
+
+func tdBucket(ns int64) int {
+	if ns < tdSubBuckets {
+		if ns < 0 {
+			return 0
+		}
+		return int(ns)
+	}
+	exp := bits.Len64(uint64(ns)) - 1
+	shift := uint(exp - tdSubBucketBits)
+	sub := int(ns>>shift) & (tdSubBuckets - 1)
+	return (exp-tdSubBucketBits+1)*tdSubBuckets + sub
+}
+
+// Lowest and highest values recorded in a bucket
+func tdBucketRange(bucket int) (int64, int64) {
+	if bucket < tdSubBuckets {
+		return int64(bucket), int64(bucket)
+	}
+	exp := uint(bucket/tdSubBuckets + tdSubBucketBits - 1)
+	sub := int64(bucket % tdSubBuckets)
+	shift := exp - tdSubBucketBits
+	low := (tdSubBuckets + sub) << shift
+	return low, low + (1 << shift) - 1
 }
 
 func (d *TimeDuration) Add(delta time.Duration) {
-	d.duration += delta.Nanoseconds()
+	ns := delta.Nanoseconds()
+	d.duration += ns
 	d.counter++
+	d.buckets[tdBucket(ns)]++
+	if ns > d.max {
+		d.max = ns
+	}
 }
 
 func (d *TimeDuration) MeanTimeUsecs() float64 {
@@ -44,6 +89,94 @@ func (d *TimeDuration) DeltaMeanTimeUsecs(prev *TimeDuration) float64 {
 	return delta.MeanTimeUsecs()
 }
 
+// Latency under which p percent of the samples fall.
+// p is between 0 and 100.
+func (d *TimeDuration) PercentileUsecs(p float64) float64 {
+	if d.counter == 0 {
+		return 0.0
+	}
+
+	rank := int64(math.Ceil(p / 100.0 * float64(d.counter)))
+	if rank < 1 {
+		rank = 1
+	}
+
+	var seen int64
+	for bucket, count := range d.buckets {
+		seen += count
+		if seen >= rank {
+			low, high := tdBucketRange(bucket)
+			value := low + (high-low)/2
+			if value > d.max {
+				value = d.max
+			}
+			return float64(value) / 1000.0
+		}
+	}
+
+	return d.MaxUsecs()
+}
+
+func (d *TimeDuration) MaxUsecs() float64 {
+	return float64(d.max) / 1000.0
+}
+
+// Samples recorded since prev.  The maximum is estimated
+// from the highest bucket which received samples.
+func (d *TimeDuration) Delta(prev *TimeDuration) *TimeDuration {
+	delta := &TimeDuration{}
+	delta.duration = d.duration - prev.duration
+	delta.counter = d.counter - prev.counter
+	for bucket := range d.buckets {
+		delta.buckets[bucket] = d.buckets[bucket] - prev.buckets[bucket]
+		if delta.buckets[bucket] != 0 {
+			_, delta.max = tdBucketRange(bucket)
+		}
+	}
+	if delta.max > d.max {
+		delta.max = d.max
+	}
+	return delta
+}
+
+func (d *TimeDuration) DeltaPercentileUsecs(prev *TimeDuration, p float64) float64 {
+	return d.Delta(prev).PercentileUsecs(p)
+}
+
+// p50, p90, p99, p99.9 and max latency
+func (d *TimeDuration) PercentilesUsecs() []float64 {
+	return []float64{
+		d.PercentileUsecs(50),
+		d.PercentileUsecs(90),
+		d.PercentileUsecs(99),
+		d.PercentileUsecs(99.9),
+		d.MaxUsecs(),
+	}
+}
+
+func (d *TimeDuration) PercentilesString() string {
+	p := d.PercentilesUsecs()
+	return fmt.Sprintf("p50 %.2f, p90 %.2f, p99 %.2f, p99.9 %.2f, max %.2f usecs",
+		p[0], p[1], p[2], p[3], p[4])
+}
+
+func (d *TimeDuration) MarshalJSON() ([]byte, error) {
+	p := d.PercentilesUsecs()
+	return json.Marshal(struct {
+		Count int64   `json:"count"`
+		Mean  float64 `json:"mean_usecs"`
+		P50   float64 `json:"p50_usecs"`
+		P90   float64 `json:"p90_usecs"`
+		P99   float64 `json:"p99_usecs"`
+		P999  float64 `json:"p99.9_usecs"`
+		Max   float64 `json:"max_usecs"`
+	}{
+		d.counter,
+		d.MeanTimeUsecs(),
+		p[0], p[1], p[2], p[3], p[4],
+	})
+}
+
 func (d *TimeDuration) Copy() *TimeDuration {
 	tdcopy := &TimeDuration{}
 	*tdcopy = *d
@@ -52,7 +185,9 @@ func (d *TimeDuration) Copy() *TimeDuration {
 
 func (d *TimeDuration) String() string {
 	return fmt.Sprintf("duration = %v\n"+
-		"counter = %v\n",
+		"counter = %v\n"+
+		"max = %v\n",
 		d.duration,
-		d.counter)
+		d.counter,
+		d.max)
 }
@@ -0,0 +1,101 @@
+//
+// Copyright (c) 2014 The foocsim Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTimeDurationBuckets(t *testing.T) {
+	// Exact for small values
+	for ns := int64(0); ns < tdSubBuckets; ns++ {
+		low, high := tdBucketRange(tdBucket(ns))
+		assert.Equal(t, ns, low)
+		assert.Equal(t, ns, high)
+	}
+
+	// Every value falls within its bucket, and buckets are contiguous
+	prevhigh := int64(tdSubBuckets - 1)
+	for bucket := tdSubBuckets; bucket < tdBuckets; bucket++ {
+		low, high := tdBucketRange(bucket)
+		assert.Equal(t, prevhigh+1, low)
+		assert.Equal(t, bucket, tdBucket(low))
+		assert.Equal(t, bucket, tdBucket(high))
+		prevhigh = high
+	}
+	assert.Equal(t, int64(math.MaxInt64), prevhigh)
+}
+
+func TestTimeDurationPercentiles(t *testing.T) {
+	d := &TimeDuration{}
+	assert.Equal(t, 0.0, d.PercentileUsecs(50))
+
+	// 1..1000 usecs
+	for i := 1; i <= 1000; i++ {
+		d.Add(time.Duration(i) * time.Microsecond)
+	}
+
+	assert.InDelta(t, 500.5, d.MeanTimeUsecs(), 0.001)
+	assert.InDelta(t, 500, d.PercentileUsecs(50), 500*0.0625)
+	assert.InDelta(t, 900, d.PercentileUsecs(90), 900*0.0625)
+	assert.InDelta(t, 990, d.PercentileUsecs(99), 990*0.0625)
+	assert.InDelta(t, 999, d.PercentileUsecs(99.9), 999*0.0625)
+	assert.Equal(t, 1000.0, d.MaxUsecs())
+	assert.True(t, d.PercentileUsecs(100) <= d.MaxUsecs())
+	assert.Equal(t, 5, len(d.PercentilesUsecs()))
+}
+
+func TestTimeDurationDelta(t *testing.T) {
+	d := &TimeDuration{}
+	for i := 0; i < 100; i++ {
+		d.Add(time.Millisecond)
+	}
+	prev := d.Copy()
+	for i := 0; i < 100; i++ {
+		d.Add(10 * time.Microsecond)
+	}
+
+	// Copy must not share the histogram
+	assert.Equal(t, int64(100), prev.counter)
+
+	delta := d.Delta(prev)
+	assert.Equal(t, int64(100), delta.counter)
+	assert.InDelta(t, 10, delta.MeanTimeUsecs(), 0.001)
+	assert.InDelta(t, 10, d.DeltaPercentileUsecs(prev, 99), 10*0.0625)
+	assert.InDelta(t, 10, delta.MaxUsecs(), 10*0.0625)
+	assert.Equal(t, 1000.0, d.MaxUsecs())
+}
+
+func TestTimeDurationMarshalJSON(t *testing.T) {
+	d := &TimeDuration{}
+	for i := 1; i <= 10; i++ {
+		d.Add(time.Duration(i) * time.Microsecond)
+	}
+
+	b, err := json.Marshal(d)
+	assert.NoError(t, err)
+
+	var m map[string]float64
+	assert.NoError(t, json.Unmarshal(b, &m))
+	assert.Equal(t, 10.0, m["count"])
+	assert.InDelta(t, 5.5, m["mean_usecs"], 0.001)
+	assert.Equal(t, 10.0, m["max_usecs"])
+	assert.Contains(t, m, "p99.9_usecs")
+}